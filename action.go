@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// --- Threshold Actions ---
+
+// defaultActionCooldown keeps a flapping metric from re-running its
+// remediation command on every warn/crit transition.
+const defaultActionCooldown = 5 * time.Minute
+
+// runActions fires on_warn/on_crit when the severity moves up into that
+// level. It never re-runs while the metric stays breached, and at most once
+// per action_cooldown per level even if the value flaps across the threshold.
+func (s *MetricState) runActions(sev, prev string, value float64, timeout time.Duration) {
+	if sev == prev || sev == "ok" || (prev == "crit" && sev == "warn") {
+		return
+	}
+
+	command := s.Config.OnWarn
+	if sev == "crit" {
+		command = s.Config.OnCrit
+	}
+	if command == "" {
+		return
+	}
+
+	cooldown := s.Config.ActionCooldown
+	if cooldown == 0 {
+		cooldown = defaultActionCooldown
+	}
+	if s.lastAction == nil {
+		s.lastAction = make(map[string]time.Time)
+	}
+	now := s.now()
+	if last, ok := s.lastAction[sev]; ok && now.Sub(last) < cooldown {
+		logDebugf("%s: on_%s skipped, last run %s ago", s.Name, sev, now.Sub(last).Round(time.Second))
+		return
+	}
+	s.lastAction[sev] = now
+
+	env := append(os.Environ(),
+		"SM_METRIC="+s.Name,
+		"SM_SEVERITY="+sev,
+		fmt.Sprintf("SM_VALUE=%g", value),
+	)
+	// Run detached so a slow command never holds up the collect loop.
+	go runAction(s.Name, sev, command, env, timeout)
+}
+
+// runAction executes command through the shell and logs its exit status.
+func runAction(name, sev, command string, env []string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		logErrorf("%s: on_%s timed out after %s: %s", name, sev, timeout, command)
+	case errors.As(err, &exitErr):
+		logErrorf("%s: on_%s exited with status %d: %s", name, sev, exitErr.ExitCode(), output)
+	case err != nil:
+		logErrorf("%s: on_%s failed: %v", name, sev, err)
+	default:
+		logInfof("%s: on_%s completed: %s", name, sev, command)
+		if output != "" {
+			logDebugf("%s: on_%s output: %s", name, sev, output)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// --- Alerts ---
+//
+// Alerting outputs (ntfy, gotify, ...) notify people, so unlike the other
+// sinks they don't forward every broadcast: they send when a metric's
+// severity rises to warn or crit, and when it falls back to ok. Metrics
+// without warn/crit thresholds never alert.
+
+// alerter marks the alerting sinks and others that follow severity, such
+// as Nagios check results. Besides broadcasts, they are handed every
+// severity change as it is collected (see MetricState.alert), since diff,
+// interval, max_broadcast_rate or quiet hours may hold back the broadcast
+// that would otherwise carry it.
+type alerter interface {
+	alerting()
+}
+
+// isAlertSink looks through the retry queue for an alerter.
+func isAlertSink(sink Sink) bool {
+	if u, ok := sink.(interface{ Unwrap() Sink }); ok {
+		sink = u.Unwrap()
+	}
+	_, ok := sink.(alerter)
+	return ok
+}
+
+// alertTracker remembers the last severity alerted per metric. Sinks call
+// check before sending and record once delivered, so a failed send is
+// retried by the queue as the same transition.
+type alertTracker struct {
+	mu       sync.Mutex
+	severity map[string]string
+}
+
+func newAlertTracker() *alertTracker {
+	return &alertTracker{severity: map[string]string{}}
+}
+
+// check returns the severity last alerted for s's metric and whether s
+// should alert. Events, summaries and unchanged severities don't; a drop
+// from crit to warn is recorded without alerting, since the metric is
+// still breached.
+func (a *alertTracker) check(s Sample) (string, bool) {
+	if s.Event != "" || s.Values != nil {
+		return "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prev, ok := a.severity[s.Name]
+	if !ok {
+		prev = "ok"
+	}
+	if s.Severity == prev {
+		return prev, false
+	}
+	if prev == "crit" && s.Severity == "warn" {
+		a.severity[s.Name] = s.Severity
+		return prev, false
+	}
+	return prev, true
+}
+
+func (a *alertTracker) record(s Sample) {
+	a.mu.Lock()
+	a.severity[s.Name] = s.Severity
+	a.mu.Unlock()
+}
+
+// alertData is what alert title/message templates can reference.
+type alertData struct {
+	Name      string
+	Host      string
+	Value     float64
+	Label     string
+	Unit      string
+	Severity  string // warn, crit, or ok on recovery
+	Previous  string // Severity before this alert
+	Threshold float64
+	Time      time.Time
+	Text      string // The broadcast line
+}
+
+func newAlertData(s Sample, prev string) alertData {
+	return alertData{
+		Name:      s.Name,
+		Host:      hostName(),
+		Value:     s.Value,
+		Label:     s.Label,
+		Unit:      s.Unit,
+		Severity:  s.Severity,
+		Previous:  prev,
+		Threshold: s.Threshold,
+		Time:      s.Time,
+		Text:      s.Text(),
+	}
+}
+
+// Default alert texts, e.g. "web1: disk_var CRIT" and
+// "disk_var: 93.10 (crit threshold 90)".
+const (
+	defaultAlertTitle   = `{{.Host}}: {{.Name}} {{if eq .Severity "ok"}}RECOVERED{{else}}{{upper .Severity}}{{end}}`
+	defaultAlertMessage = `{{.Text}}{{if ne .Severity "ok"}} ({{.Severity}} threshold {{.Threshold}}){{end}}`
+)
+
+var alertFuncs = template.FuncMap{"upper": strings.ToUpper}
+
+// parseAlertTemplate parses text, or def when text is empty.
+func parseAlertTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	t, err := template.New(name).Funcs(alertFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+func renderAlert(t *template.Template, d alertData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const powerSupplyDir = "/sys/class/power_supply"
+
+// batteryValue reads a battery from /sys/class/power_supply. name selects a
+// supply (e.g. "BAT0"); empty picks the first one of type Battery or UPS.
+func batteryValue(name, measure string) (float64, error) {
+	dir, err := findBattery(name)
+	if err != nil {
+		return 0, err
+	}
+	status := readSysString(filepath.Join(dir, "status"))
+
+	switch measure {
+	case "percent", "":
+		if v, err := readSysFloat(filepath.Join(dir, "capacity")); err == nil {
+			return v, nil
+		}
+		// Some fuel gauges (and UPS drivers) only report levels.
+		for _, kind := range []string{"energy", "charge"} {
+			now, errNow := readSysFloat(filepath.Join(dir, kind+"_now"))
+			full, errFull := readSysFloat(filepath.Join(dir, kind+"_full"))
+			if errNow == nil && errFull == nil && full > 0 {
+				return min(now/full*100, 100), nil
+			}
+		}
+		return 0, fmt.Errorf("battery %s reports no capacity", filepath.Base(dir))
+
+	case "on_ac":
+		return onExternalPower(status), nil
+
+	case "charging":
+		if status == "Charging" || status == "Full" {
+			return 1.0, nil
+		}
+		return 0.0, nil
+
+	case "time_remaining_minutes":
+		// Only meaningful while running on the battery.
+		if status != "Discharging" {
+			return 0, errNotReady
+		}
+		// The driver's own estimate, where there is one (UPSes, some EC
+		// firmware), knows the discharge curve better than a linear one.
+		if secs, err := readSysFloat(filepath.Join(dir, "time_to_empty_now")); err == nil && secs > 0 {
+			return secs / 60, nil
+		}
+		// Drivers expose either energy (µWh / µW) or charge (µAh / µA).
+		now, errNow := readSysFloat(filepath.Join(dir, "energy_now"))
+		rate, errRate := readSysFloat(filepath.Join(dir, "power_now"))
+		if errNow != nil || errRate != nil {
+			now, errNow = readSysFloat(filepath.Join(dir, "charge_now"))
+			rate, errRate = readSysFloat(filepath.Join(dir, "current_now"))
+		}
+		if errNow != nil || errRate != nil {
+			return 0, fmt.Errorf("battery %s reports no energy/charge rate", filepath.Base(dir))
+		}
+		if rate <= 0 {
+			return 0, errNotReady
+		}
+		return now / rate * 60, nil
+	}
+	return 0, fmt.Errorf("unknown battery measure %q", measure)
+}
+
+func findBattery(name string) (string, error) {
+	if name != "" {
+		dir := filepath.Join(powerSupplyDir, name)
+		if _, err := os.Stat(dir); err != nil {
+			return "", fmt.Errorf("battery %s: %w", name, errUnsupported)
+		}
+		return dir, nil
+	}
+	entries, err := os.ReadDir(powerSupplyDir)
+	if err != nil {
+		return "", fmt.Errorf("no %s: %w", powerSupplyDir, errUnsupported)
+	}
+	for _, e := range entries {
+		dir := filepath.Join(powerSupplyDir, e.Name())
+		if t := readSysString(filepath.Join(dir, "type")); t == "Battery" || t == "UPS" {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no battery found: %w", errUnsupported)
+}
+
+// onExternalPower is 1 when a mains, USB or wireless supply reports
+// online. Hosts without one (a UPS HAT on an SBC exposes only the battery)
+// fall back to the battery's status: anything but discharging is on power.
+func onExternalPower(batteryStatus string) float64 {
+	entries, _ := os.ReadDir(powerSupplyDir)
+	external := false
+	for _, e := range entries {
+		dir := filepath.Join(powerSupplyDir, e.Name())
+		if t := readSysString(filepath.Join(dir, "type")); t == "Battery" || t == "UPS" {
+			continue
+		}
+		switch readSysString(filepath.Join(dir, "online")) {
+		case "1":
+			return 1
+		case "0":
+			external = true
+		}
+	}
+	if external || batteryStatus == "Discharging" {
+		return 0
+	}
+	return 1
+}
+
+func readSysString(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readSysFloat(path string) (float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+}
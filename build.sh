@@ -57,7 +57,7 @@ for PLATFORM in "${PLATFORMS[@]}"; do
     BIN_NAME="${APP_NAME}-${GOOS}-${GOARCH}"
 
     echo "Building for $GOOS/$GOARCH..."
-    env GOOS=$GOOS GOARCH=$GOARCH go build -o "$LATEST_DIR/$BIN_NAME" main.go
+    env GOOS=$GOOS GOARCH=$GOARCH go build -o "$LATEST_DIR/$BIN_NAME" .
 done
 
 # --- 3. Copy Static Assets to Latest ---
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// --- Value Cache ---
+//
+// Every successful collection lands here, independent of whether it was
+// broadcast, along with the state's status once the collection is done.
+// Readers such as the HTTP endpoints serve from the cache so their request
+// rate never drives the (possibly expensive) collectors, and they never
+// touch a state, so a hung collector can't hold them up.
+
+type cachedValue struct {
+	Value float64
+	Time  time.Time
+}
+
+// stateStatus is what a state last reported: its broadcast, severity and
+// collection error.
+type stateStatus struct {
+	Severity      string
+	LastValue     float64   // Last broadcast value
+	LastBroadcast time.Time // Zero before the first broadcast
+	LastError     string    // Empty when the last collection succeeded
+	LastErrorTime time.Time
+}
+
+type valueCache struct {
+	mu     sync.RWMutex
+	m      map[string]cachedValue
+	status map[string]stateStatus
+	ttl    time.Duration // Values older than this are stale; 0 never expires
+}
+
+var metricCache = &valueCache{m: map[string]cachedValue{}, status: map[string]stateStatus{}}
+
+func (c *valueCache) set(name string, v float64, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[name] = cachedValue{Value: v, Time: t}
+}
+
+func (c *valueCache) get(name string) (cachedValue, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.m[name]
+	return v, ok
+}
+
+func (c *valueCache) setStatus(name string, st stateStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status[name] = st
+}
+
+// statusOf returns the status last published for name; a state that hasn't
+// finished a collection yet is ok with nothing broadcast.
+func (c *valueCache) statusOf(name string) stateStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st, ok := c.status[name]
+	if !ok {
+		st.Severity = "ok"
+	}
+	return st
+}
+
+// age is how long ago the value was collected.
+func (cv cachedValue) age(now time.Time) time.Duration {
+	return now.Sub(cv.Time)
+}
+
+func (c *valueCache) stale(cv cachedValue, now time.Time) bool {
+	return c.ttl > 0 && cv.age(now) > c.ttl
+}
+
+// --- Per-Tick Snapshots ---
+//
+// Sources that report on many things at once (all interfaces from one
+// /proc/net/dev read, all block devices from one /proc/diskstats read, all
+// GPUs from one nvidia-smi run, all TCP sockets from one /proc/net/tcp
+// read, all of a disk's SMART data from one smartctl run, all pools from
+// one zpool list) are read at most once per tick and shared by every state
+// collecting in that tick. Besides saving reads, this makes all values
+// derived from a tick consistent: same counters, same timestamp.
+
+type tickSnapshot struct {
+	at time.Time
+
+	net   tickRead[[]net.IOCountersStat]
+	disk  tickRead[map[string]disk.IOCountersStat]
+	gpu   tickRead[[]gpuStat]
+	tcp   tickRead[[]tcpSocket]
+	zpool tickRead[[]zpoolStat]
+
+	smartMu sync.Mutex
+	smartBy map[string]*tickRead[*smartReport] // By device
+}
+
+// tickRead is one shared read. The read runs under the context of whichever
+// state gets there first, so a failure after that context ended is that
+// state's timeout, not the source's: it isn't kept, and the next state
+// reads again under its own deadline.
+type tickRead[T any] struct {
+	mu   sync.Mutex
+	done bool
+	val  T
+	err  error
+}
+
+func (r *tickRead[T]) get(ctx context.Context, read func(context.Context) (T, error)) (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.done {
+		r.val, r.err = read(ctx)
+		r.done = r.err == nil || ctx.Err() == nil
+	}
+	return r.val, r.err
+}
+
+var (
+	tickMu sync.Mutex
+	tick   = &tickSnapshot{at: time.Now()}
+)
+
+// beginTick starts a fresh snapshot; called before each collection pass.
+func beginTick(at time.Time) {
+	tickMu.Lock()
+	tick = &tickSnapshot{at: at}
+	tickMu.Unlock()
+}
+
+func currentTick() *tickSnapshot {
+	tickMu.Lock()
+	defer tickMu.Unlock()
+	return tick
+}
+
+// netCounters returns this tick's per-interface counters, reading them on
+// first use.
+func (t *tickSnapshot) netCounters(ctx context.Context) ([]net.IOCountersStat, error) {
+	return t.net.get(ctx, func(ctx context.Context) ([]net.IOCountersStat, error) {
+		return net.IOCountersWithContext(ctx, true)
+	})
+}
+
+// diskCounters returns this tick's per-device I/O counters, reading them on
+// first use.
+func (t *tickSnapshot) diskCounters(ctx context.Context) (map[string]disk.IOCountersStat, error) {
+	return t.disk.get(ctx, func(ctx context.Context) (map[string]disk.IOCountersStat, error) {
+		return disk.IOCountersWithContext(ctx)
+	})
+}
+
+// gpus returns this tick's GPU readings, running nvidia-smi on first use.
+func (t *tickSnapshot) gpus(ctx context.Context) ([]gpuStat, error) {
+	return t.gpu.get(ctx, queryGPUs)
+}
+
+// tcpSockets returns this tick's TCP sockets, reading them on first use.
+func (t *tickSnapshot) tcpSockets(ctx context.Context) ([]tcpSocket, error) {
+	return t.tcp.get(ctx, func(context.Context) ([]tcpSocket, error) {
+		return readTCPSockets()
+	})
+}
+
+// zpools returns this tick's ZFS pools, running zpool list on first use.
+func (t *tickSnapshot) zpools(ctx context.Context) ([]zpoolStat, error) {
+	return t.zpool.get(ctx, listZpools)
+}
+
+// smart returns this tick's SMART data for device, running smartctl on
+// first use.
+func (t *tickSnapshot) smart(ctx context.Context, device string) (*smartReport, error) {
+	t.smartMu.Lock()
+	if t.smartBy == nil {
+		t.smartBy = map[string]*tickRead[*smartReport]{}
+	}
+	r, ok := t.smartBy[device]
+	if !ok {
+		r = &tickRead[*smartReport]{}
+		t.smartBy[device] = r
+	}
+	t.smartMu.Unlock()
+	return r.get(ctx, func(ctx context.Context) (*smartReport, error) {
+		return readSMART(ctx, device)
+	})
+}
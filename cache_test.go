@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTickReadRetriesAfterCallerTimeout(t *testing.T) {
+	var r tickRead[int]
+	reads := 0
+	read := func(ctx context.Context) (int, error) {
+		reads++
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return 42, nil
+	}
+
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.get(expired, read); !errors.Is(err, context.Canceled) {
+		t.Fatalf("first read: err %v, want context.Canceled", err)
+	}
+	// The next state has time left and must not inherit the timeout.
+	if v, err := r.get(context.Background(), read); err != nil || v != 42 {
+		t.Fatalf("second read: %d, %v; want 42", v, err)
+	}
+	if v, _ := r.get(context.Background(), read); v != 42 || reads != 2 {
+		t.Fatalf("third read: %d after %d reads, want 42 from the cache", v, reads)
+	}
+}
+
+func TestTickReadKeepsSourceErrors(t *testing.T) {
+	var r tickRead[int]
+	reads := 0
+	failing := errors.New("zpool: command not found")
+	read := func(context.Context) (int, error) {
+		reads++
+		return 0, failing
+	}
+	for range 3 {
+		if _, err := r.get(context.Background(), read); err != failing {
+			t.Fatalf("err %v, want %v", err, failing)
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("%d reads, want 1 per tick", reads)
+	}
+}
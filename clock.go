@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// --- Time Source ---
+
+// Clock is where a MetricState gets the current time. Throttling, heartbeat
+// and rate math go through it so they can be driven by a fakeClock instead
+// of real sleeps.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock(t time.Time) *fakeClock { return &fakeClock{t: t} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// now returns the state's clock time, falling back to the wall clock for
+// states not built by newMetricState.
+func (s *MetricState) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
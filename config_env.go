@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Environment Configuration ---
+//
+// With no config file, the config is assembled from the environment:
+//
+//	SM_GLOBAL_<KEY>=<value>          e.g. SM_GLOBAL_CHECK_FREQUENCY=5s
+//	SM_METRIC_<NAME>_<KEY>=<value>   e.g. SM_METRIC_CPU_MEASURE=total
+//	SM_OUTPUT_<NAME>_<KEY>=<value>   e.g. SM_OUTPUT_NTFY_TOPIC=alerts
+//
+// Keys are the YAML keys upper-cased; metric names are lower-cased. Since
+// both may contain underscores, the longest known key suffix wins
+// (SM_METRIC_DISK_ROOT_RESEND_INTERVAL is metric "disk_root", key
+// "resend_interval"). Output names are fixed, so there the longest known
+// name prefix wins (SM_OUTPUT_SNMP_TRAP_TARGET is output "snmp_trap", key
+// "target"). Values are parsed as YAML, so numbers, booleans and
+// flow lists/maps (e.g. SM_METRIC_CPU_SINKS=[log]) work as in the file.
+
+const envPrefix = "SM_"
+
+func configFromEnv(environ []string) ([]byte, error) {
+	global := map[string]any{}
+	metrics := map[string]map[string]any{}
+	outputs := map[string]map[string]any{}
+	metricKeys := yamlKeys(reflect.TypeOf(MetricConfig{}))
+	outputNames := yamlKeys(reflect.TypeOf(OutputsConfig{}))
+
+	for _, kv := range environ {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(k, envPrefix) {
+			continue
+		}
+		var val any
+		if err := yaml.Unmarshal([]byte(v), &val); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+
+		rest := strings.TrimPrefix(k, envPrefix)
+		switch {
+		case strings.HasPrefix(rest, "GLOBAL_"):
+			global[strings.ToLower(strings.TrimPrefix(rest, "GLOBAL_"))] = val
+		case strings.HasPrefix(rest, "METRIC_"):
+			name, key, ok := splitMetricEnv(strings.TrimPrefix(rest, "METRIC_"), metricKeys)
+			if !ok {
+				return nil, fmt.Errorf("%s: no known metric key suffix", k)
+			}
+			if metrics[name] == nil {
+				metrics[name] = map[string]any{}
+			}
+			metrics[name][key] = val
+		case strings.HasPrefix(rest, "OUTPUT_"):
+			name, key, ok := splitOutputEnv(strings.TrimPrefix(rest, "OUTPUT_"), outputNames)
+			if !ok {
+				return nil, fmt.Errorf("%s: no known output name prefix", k)
+			}
+			if outputs[name] == nil {
+				outputs[name] = map[string]any{}
+			}
+			outputs[name][key] = val
+		}
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no config file given and no %sMETRIC_* variables set", envPrefix)
+	}
+	return yaml.Marshal(map[string]any{"global": global, "metrics": metrics, "outputs": outputs})
+}
+
+// splitMetricEnv splits "DISK_ROOT_RESEND_INTERVAL" into ("disk_root",
+// "resend_interval") using the longest matching key.
+func splitMetricEnv(s string, keys []string) (string, string, bool) {
+	lower := strings.ToLower(s)
+	for _, key := range keys {
+		if name, ok := strings.CutSuffix(lower, "_"+key); ok && name != "" {
+			return name, key, true
+		}
+	}
+	return "", "", false
+}
+
+// splitOutputEnv splits "SNMP_TRAP_TARGET" into ("snmp_trap", "target")
+// using the longest matching output name.
+func splitOutputEnv(s string, names []string) (string, string, bool) {
+	lower := strings.ToLower(s)
+	for _, name := range names {
+		if key, ok := strings.CutPrefix(lower, name+"_"); ok && key != "" {
+			return name, key, true
+		}
+	}
+	return "", "", false
+}
+
+// yamlKeys lists a struct's yaml keys, longest first.
+func yamlKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if tag != "" && tag != "-" {
+			keys = append(keys, tag)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	return keys
+}
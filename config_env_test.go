@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	f, err := configFromEnv([]string{
+		"PATH=/usr/bin",
+		"SM_GLOBAL_CHECK_FREQUENCY=5s",
+		"SM_METRIC_DISK_ROOT_TYPE=disk",
+		"SM_METRIC_DISK_ROOT_RESEND_INTERVAL=1h",
+		"SM_METRIC_DISK_ROOT_SINKS=[log, snmp_trap]",
+		"SM_OUTPUT_NTFY_TOPIC=alerts",
+		"SM_OUTPUT_SNMP_TRAP_TARGET=nms:162",
+		"SM_OUTPUT_LOG_ENABLED=false",
+	})
+	if err != nil {
+		t.Fatalf("configFromEnv: %v", err)
+	}
+	var got map[string]any
+	if err := yaml.Unmarshal(f, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"global": map[string]any{"check_frequency": "5s"},
+		"metrics": map[string]any{
+			"disk_root": map[string]any{"type": "disk", "resend_interval": "1h", "sinks": []any{"log", "snmp_trap"}},
+		},
+		"outputs": map[string]any{
+			"ntfy":      map[string]any{"topic": "alerts"},
+			"snmp_trap": map[string]any{"target": "nms:162"},
+			"log":       map[string]any{"enabled": false},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %#v\nwant %#v", got, want)
+	}
+}
+
+func TestConfigFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+	}{
+		{"no metrics", []string{"SM_GLOBAL_CHECK_FREQUENCY=5s"}},
+		{"unknown metric key", []string{"SM_METRIC_CPU_COLOUR=red"}},
+		{"unknown output", []string{"SM_METRIC_CPU_TYPE=cpu", "SM_OUTPUT_PIGEON_URL=x"}},
+		{"output without key", []string{"SM_METRIC_CPU_TYPE=cpu", "SM_OUTPUT_NTFY=x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := configFromEnv(tt.env); err == nil {
+				t.Fatalf("no error for %v", tt.env)
+			}
+		})
+	}
+}
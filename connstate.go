@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- TCP Connection States ---
+//
+// Counts sockets by state from /proc/net/tcp and tcp6, which is cheap even
+// with many connections (unlike walking every process's fds). Both files are
+// read once per tick and shared by every net_conn metric.
+
+// tcpStates maps measures to the kernel's state numbers (include/net/tcp_states.h).
+var tcpStates = map[string]uint8{
+	"established":  0x01,
+	"syn_sent":     0x02,
+	"syn_recv":     0x03,
+	"fin_wait1":    0x04,
+	"fin_wait2":    0x05,
+	"time_wait":    0x06,
+	"close":        0x07,
+	"close_wait":   0x08,
+	"last_ack":     0x09,
+	"listen":       0x0a,
+	"closing":      0x0b,
+	"new_syn_recv": 0x0c,
+}
+
+// tcpSocket is one line of /proc/net/tcp{,6}.
+type tcpSocket struct {
+	localPort uint16
+	state     uint8
+	rxQueue   uint64 // For listeners: connections waiting to be accepted
+}
+
+func readTCPSockets() ([]tcpSocket, error) {
+	var socks []tcpSocket
+	read := 0
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // No IPv6
+		}
+		if err != nil {
+			return nil, err
+		}
+		read++
+		sc := bufio.NewScanner(f)
+		sc.Scan() // Header
+		for sc.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue ...
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 5 {
+				continue
+			}
+			_, port, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			p, err1 := strconv.ParseUint(port, 16, 16)
+			st, err2 := strconv.ParseUint(fields[3], 16, 8)
+			_, rx, _ := strings.Cut(fields[4], ":")
+			q, err3 := strconv.ParseUint(rx, 16, 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			socks = append(socks, tcpSocket{localPort: uint16(p), state: uint8(st), rxQueue: q})
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if read == 0 {
+		return nil, fmt.Errorf("no /proc/net/tcp: %w", errUnsupported)
+	}
+	return socks, nil
+}
+
+// netConnValue counts sockets in the state named by measure (default
+// established), optionally only those on local port. total is every state
+// but listen; accept_queue sums the connections waiting in listeners'
+// accept queues, which grows when the application falls behind.
+func netConnValue(ctx context.Context, measure string, port int) (float64, error) {
+	socks, err := currentTick().tcpSockets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if measure == "" {
+		measure = "established"
+	}
+	want, known := tcpStates[measure]
+	if !known && measure != "total" && measure != "accept_queue" {
+		return 0, fmt.Errorf("unknown net_conn measure %q", measure)
+	}
+
+	var n float64
+	for _, s := range socks {
+		if port != 0 && int(s.localPort) != port {
+			continue
+		}
+		switch {
+		case measure == "accept_queue":
+			if s.state == tcpStates["listen"] {
+				n += float64(s.rxQueue)
+			}
+		case measure == "total":
+			if s.state != tcpStates["listen"] {
+				n++
+			}
+		case s.state == want:
+			n++
+		}
+	}
+	return n, nil
+}
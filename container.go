@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// --- Container Metrics (cgroups) ---
+//
+// Containers are found through the Docker API when its socket is available
+// (names and labels), otherwise by enumerating docker cgroups (IDs only).
+// Resource usage is always read straight from the cgroup files, v1 or v2;
+// running state and restart count come from the API.
+
+const (
+	dockerSocket = "/var/run/docker.sock"
+	cgroupRoot   = "/sys/fs/cgroup"
+)
+
+var dockerClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", dockerSocket)
+		},
+	},
+}
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+	State  string            `json:"State"`
+}
+
+func (c dockerContainer) name() string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return shortID(c.ID)
+}
+
+// matches applies the optional container name and "key=value" label filters.
+func (c dockerContainer) matches(name, label string) bool {
+	if name != "" && c.name() != name && !strings.HasPrefix(c.ID, name) {
+		return false
+	}
+	if label != "" {
+		k, v, _ := strings.Cut(label, "=")
+		if got, ok := c.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// listContainers returns running containers, preferring the Docker API,
+// and with all, stopped ones too (only known to the API). ok is false when
+// neither Docker nor docker cgroups are present.
+func listContainers(all bool) (list []dockerContainer, ok bool, err error) {
+	if _, statErr := os.Stat(dockerSocket); statErr == nil {
+		endpoint := "http://docker/containers/json"
+		if all {
+			endpoint += "?all=1"
+		}
+		resp, err := dockerClient.Get(endpoint)
+		if err != nil {
+			return nil, true, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, true, fmt.Errorf("docker API: %s", resp.Status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			return nil, true, err
+		}
+		return list, true, nil
+	}
+
+	ids := cgroupContainerIDs()
+	if ids == nil {
+		return nil, false, nil
+	}
+	for _, id := range ids {
+		list = append(list, dockerContainer{ID: id, State: "running"})
+	}
+	return list, true, nil
+}
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// cgroupContainerIDs finds docker container IDs by their cgroup
+// directories (systemd and cgroupfs drivers, v1 and v2).
+func cgroupContainerIDs() []string {
+	patterns := []string{
+		cgroupRoot + "/system.slice/docker-*.scope",
+		cgroupRoot + "/docker/*",
+		cgroupRoot + "/memory/system.slice/docker-*.scope",
+		cgroupRoot + "/memory/docker/*",
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, p := range patterns {
+		matches, _ := filepath.Glob(p)
+		for _, m := range matches {
+			id := containerIDPattern.FindString(filepath.Base(m))
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// discoverContainers expands a container_auto entry into one config per
+// running container matching the optional label filter. For the running
+// measure stopped containers are kept as well, so one that exits reads 0
+// instead of disappearing. ok is false when listing failed, so callers
+// don't mistake an API hiccup for "no containers".
+func discoverContainers(key string, config MetricConfig) (map[string]MetricConfig, bool) {
+	withStopped := config.Measure == "running"
+	list, ok, err := listContainers(withStopped)
+	if err != nil {
+		logErrorf("%s: listing containers: %v", key, err)
+		return nil, false
+	}
+	if !ok {
+		logDebugf("%s: no container runtime found", key)
+		return nil, true
+	}
+	out := map[string]MetricConfig{}
+	for _, c := range list {
+		if (c.State != "running" && !withStopped) || !c.matches("", config.Label) {
+			continue
+		}
+		cc := config
+		cc.Container = c.ID
+		out[fmt.Sprintf("%s_%s", key, sanitizeName(c.name()))] = cc
+	}
+	return out, true
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+func sanitizeName(s string) string {
+	return unsafeNameChars.ReplaceAllString(s, "_")
+}
+
+// resolveContainer maps a configured name/ID/label to a full container ID.
+// With all, stopped containers are considered too.
+func resolveContainer(name, label string, all bool) (string, error) {
+	if containerIDPattern.MatchString(name) && len(name) == 64 {
+		return name, nil
+	}
+	list, ok, err := listContainers(all)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("no container runtime: %w", errUnsupported)
+	}
+	for _, c := range list {
+		if c.matches(name, label) {
+			return c.ID, nil
+		}
+	}
+	return "", fmt.Errorf("container %q: %w", name, errContainerGone)
+}
+
+var errContainerGone = errors.New("no such container")
+
+// dockerInspect is the part of GET /containers/{id}/json used here.
+type dockerInspect struct {
+	RestartCount int
+	State        struct {
+		Running    bool
+		Restarting bool
+	}
+}
+
+func inspectContainer(ctx context.Context, id string) (dockerInspect, error) {
+	var info dockerInspect
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/"+id+"/json", nil)
+	if err != nil {
+		return info, err
+	}
+	resp, err := dockerClient.Do(req)
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return info, fmt.Errorf("container %s: %w", shortID(id), errContainerGone)
+	default:
+		return info, fmt.Errorf("docker API: %s", resp.Status)
+	}
+	return info, json.NewDecoder(resp.Body).Decode(&info)
+}
+
+// containerStateValue reads the running and restart_count measures. A
+// container that was removed reads as not running; it is looked up by
+// name again on the next sample in case it is recreated.
+func (s *MetricState) containerStateValue(ctx context.Context) (float64, error) {
+	if _, err := os.Stat(dockerSocket); err != nil {
+		if s.Config.Measure == "running" {
+			// Without the API, a live cgroup is as good as it gets.
+			if _, err := findContainerCgroup(s.ContainerID); err != nil {
+				s.ContainerID = ""
+				return 0, nil
+			}
+			return 1, nil
+		}
+		return 0, fmt.Errorf("restart_count needs the Docker API: %w", errUnsupported)
+	}
+	info, err := inspectContainer(ctx, s.ContainerID)
+	if errors.Is(err, errContainerGone) {
+		s.ContainerID = ""
+		if s.Config.Measure == "running" {
+			return 0, nil
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case s.Config.Measure == "restart_count":
+		return float64(info.RestartCount), nil
+	case info.State.Running && !info.State.Restarting:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// containerCgroup locates the cgroup directories for a container.
+type containerCgroup struct {
+	v2     bool
+	cpuDir string
+	memDir string
+}
+
+func findContainerCgroup(id string) (containerCgroup, error) {
+	first := func(paths ...string) string {
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+		return ""
+	}
+
+	if _, err := os.Stat(cgroupRoot + "/cgroup.controllers"); err == nil {
+		dir := first(cgroupRoot+"/system.slice/docker-"+id+".scope", cgroupRoot+"/docker/"+id)
+		if dir == "" {
+			return containerCgroup{}, fmt.Errorf("no cgroup for container %s", shortID(id))
+		}
+		return containerCgroup{v2: true, cpuDir: dir, memDir: dir}, nil
+	}
+
+	cg := containerCgroup{
+		cpuDir: first(cgroupRoot+"/cpuacct/docker/"+id, cgroupRoot+"/cpuacct/system.slice/docker-"+id+".scope",
+			cgroupRoot+"/cpu,cpuacct/docker/"+id, cgroupRoot+"/cpu,cpuacct/system.slice/docker-"+id+".scope"),
+		memDir: first(cgroupRoot+"/memory/docker/"+id, cgroupRoot+"/memory/system.slice/docker-"+id+".scope"),
+	}
+	if cg.cpuDir == "" || cg.memDir == "" {
+		return containerCgroup{}, fmt.Errorf("no cgroup for container %s", shortID(id))
+	}
+	return cg, nil
+}
+
+// cpuNanos is the container's cumulative CPU time.
+func (cg containerCgroup) cpuNanos() (uint64, error) {
+	if !cg.v2 {
+		v, err := readSysFloat(cg.cpuDir + "/cpuacct.usage")
+		return uint64(v), err
+	}
+	f, err := os.Open(cg.cpuDir + "/cpu.stat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "usage_usec "); ok {
+			usec, err := strconv.ParseUint(v, 10, 64)
+			return usec * 1000, err
+		}
+	}
+	return 0, fmt.Errorf("no usage_usec in cpu.stat")
+}
+
+func (cg containerCgroup) memUsage() (float64, error) {
+	if cg.v2 {
+		return readSysFloat(cg.memDir + "/memory.current")
+	}
+	return readSysFloat(cg.memDir + "/memory.usage_in_bytes")
+}
+
+// memLimit falls back to host RAM when the container is unlimited.
+func (cg containerCgroup) memLimit(ctx context.Context) (float64, error) {
+	file := cg.memDir + "/memory.limit_in_bytes"
+	if cg.v2 {
+		file = cg.memDir + "/memory.max"
+	}
+	limit, err := readSysFloat(file)
+	vm, vmErr := mem.VirtualMemoryWithContext(ctx)
+	if vmErr != nil {
+		return 0, vmErr
+	}
+	// v2 writes "max"; v1 writes a huge page-aligned number.
+	if err != nil || limit <= 0 || limit > float64(vm.Total) {
+		return float64(vm.Total), nil
+	}
+	return limit, nil
+}
+
+func (s *MetricState) containerValue(ctx context.Context) (float64, error) {
+	stateMeasure := s.Config.Measure == "running" || s.Config.Measure == "restart_count"
+	if s.ContainerID == "" {
+		id, err := resolveContainer(s.Config.Container, s.Config.Label, stateMeasure)
+		if s.Config.Measure == "running" && errors.Is(err, errContainerGone) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.ContainerID = id
+	}
+	if stateMeasure {
+		return s.containerStateValue(ctx)
+	}
+	cg, err := findContainerCgroup(s.ContainerID)
+	if err != nil {
+		// The container may have been recreated under the same name.
+		s.ContainerID = ""
+		s.resetBaseline()
+		return 0, err
+	}
+
+	switch s.Config.Measure {
+	case "cpu_percent", "":
+		usage, err := cg.cpuNanos()
+		if err != nil {
+			return 0, err
+		}
+		if s.Config.Mode == "total" {
+			return float64(usage) / 1e9, nil // CPU seconds used
+		}
+		nanosPerSec, err := s.counterRate(usage, s.now())
+		// 100% = one full core, like `docker stats`.
+		return nanosPerSec / 1e9 * 100, err
+
+	case "mem_usage_mb":
+		used, err := cg.memUsage()
+		return used / 1024 / 1024, err
+
+	case "mem_limit_percent":
+		used, err := cg.memUsage()
+		if err != nil {
+			return 0, err
+		}
+		limit, err := cg.memLimit(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return used / limit * 100, nil
+	}
+	return 0, fmt.Errorf("unknown container measure %q", s.Config.Measure)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// --- Counter Baselines ---
+//
+// Counter metrics (network bytes, container CPU time, ...) report the change
+// between two samples. They all go through counterDelta, so the first sample
+// after startup, and the first after a counter reset, uniformly becomes the
+// new baseline and is skipped with errNotReady instead of being broadcast.
+
+// needsBaseline reports whether a counter metric has no previous sample yet.
+func (s *MetricState) needsBaseline() bool {
+	return s.LastTime.IsZero()
+}
+
+// resetBaseline forgets the previous sample, e.g. when the counter's source
+// was replaced and the next reading isn't comparable.
+func (s *MetricState) resetBaseline() {
+	s.LastRawCounter, s.LastTime = 0, time.Time{}
+}
+
+// counterDelta stores raw as the baseline and returns the increase since the
+// previous sample and the time between the two.
+func (s *MetricState) counterDelta(raw uint64, now time.Time) (float64, time.Duration, error) {
+	if s.needsBaseline() || raw < s.LastRawCounter {
+		s.LastRawCounter, s.LastTime = raw, now
+		return 0, 0, errNotReady
+	}
+	delta, elapsed := float64(raw-s.LastRawCounter), now.Sub(s.LastTime)
+	s.LastRawCounter, s.LastTime = raw, now
+	return delta, elapsed, nil
+}
+
+// counterRate is counterDelta per second.
+func (s *MetricState) counterRate(raw uint64, now time.Time) (float64, error) {
+	delta, elapsed, err := s.counterDelta(raw, now)
+	if err != nil {
+		return 0, err
+	}
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("time skew")
+	}
+	return delta / elapsed.Seconds(), nil
+}
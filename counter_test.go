@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counterStep is one counter sample and the rate it should give.
+type counterStep struct {
+	after time.Duration // Since the previous sample
+	raw   uint64
+	want  float64 // Per second
+	err   error   // errNotReady for a new baseline
+}
+
+func TestCounterRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []counterStep
+	}{
+		{"steady", []counterStep{
+			{0, 1000, 0, errNotReady},
+			{2 * time.Second, 3000, 1000, nil},
+			{time.Second, 3000, 0, nil},
+			{500 * time.Millisecond, 3500, 1000, nil},
+		}},
+		{"32-bit wrap", []counterStep{
+			{0, math.MaxUint32 - 100, 0, errNotReady},
+			{time.Second, math.MaxUint32, 100, nil},
+			{time.Second, 200, 0, errNotReady}, // Wrapped: not a negative rate
+			{2 * time.Second, 1200, 500, nil},
+		}},
+		{"reset", []counterStep{
+			{0, 5_000_000, 0, errNotReady},
+			{time.Second, 5_001_000, 1000, nil},
+			{time.Second, 0, 0, errNotReady}, // Interface re-created
+			{time.Second, 400, 400, nil},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMetricState("net", MetricConfig{Type: "net_rate"})
+			now := testStart
+			for i, st := range tt.steps {
+				now = now.Add(st.after)
+				got, err := s.counterRate(st.raw, now)
+				if !errors.Is(err, st.err) {
+					t.Fatalf("step %d: err %v, want %v", i, err, st.err)
+				}
+				if err == nil && math.Abs(got-st.want) > 1e-9 {
+					t.Fatalf("step %d: rate %g, want %g", i, got, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCounterRateTimeSkew(t *testing.T) {
+	s := newMetricState("net", MetricConfig{Type: "net_rate"})
+	if _, err := s.counterRate(100, testStart); !errors.Is(err, errNotReady) {
+		t.Fatalf("baseline: err %v, want errNotReady", err)
+	}
+	// Same timestamp again: no elapsed time to divide by.
+	if _, err := s.counterRate(200, testStart); err == nil || errors.Is(err, errNotReady) {
+		t.Fatalf("err %v, want time skew", err)
+	}
+}
+
+func TestCounterDeltaResetBaseline(t *testing.T) {
+	s := newMetricState("errs", MetricConfig{Type: "net_rate", Measure: "errin"})
+	s.counterDelta(10, testStart)
+	if d, elapsed, err := s.counterDelta(15, testStart.Add(time.Minute)); err != nil || d != 5 || elapsed != time.Minute {
+		t.Fatalf("got %g over %s (%v), want 5 over 1m0s", d, elapsed, err)
+	}
+	s.resetBaseline()
+	if !s.needsBaseline() {
+		t.Fatal("needsBaseline false after resetBaseline")
+	}
+	if _, _, err := s.counterDelta(15, testStart.Add(2*time.Minute)); !errors.Is(err, errNotReady) {
+		t.Fatalf("after reset: err %v, want errNotReady", err)
+	}
+}
+
+// TestCounterModeTotal checks that mode total reads the raw counter from the
+// first sample on, with no baseline.
+func TestCounterModeTotal(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  MetricConfig
+		raw  func() (uint64, error)
+	}{
+		{"swap pages", MetricConfig{Type: "swap", Measure: "in_pages_s", Mode: "total"},
+			func() (uint64, error) { return vmstatCounter("pswpin") }},
+		{"context switches", MetricConfig{Type: "sys_rate", Mode: "total"},
+			func() (uint64, error) { return procStatCounter("ctxt") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tt.raw()
+			if err != nil {
+				t.Skipf("counter not available: %v", err)
+			}
+			s := newMetricState("m", tt.cfg)
+			got, err := getValue(context.Background(), s)
+			if err != nil {
+				t.Fatalf("first sample: %v", err)
+			}
+			// The counter may have moved on between the two reads.
+			if got < float64(want) {
+				t.Fatalf("got %g, want the raw counter %d", got, want)
+			}
+		})
+	}
+}
+
+// procStatCounter reads one counter line from /proc/stat.
+func procStatCounter(key string) (uint64, error) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, errors.New("no " + key)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuFreqValue reads the cores' current frequency from cpufreq (avg_mhz,
+// the default, max_mhz, min_mhz) or whether the CPU is being throttled.
+func (s *MetricState) cpuFreqValue(ctx context.Context) (float64, error) {
+	if s.Config.Measure == "throttled" {
+		return s.cpuThrottled(ctx)
+	}
+	files, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq")
+	var mhz []float64
+	for _, f := range files {
+		if khz, err := readSysFloat(f); err == nil {
+			mhz = append(mhz, khz/1000)
+		}
+	}
+	if len(mhz) == 0 {
+		// No cpufreq driver (common in VMs): x86 still reports each
+		// core's clock in /proc/cpuinfo.
+		mhz = cpuinfoMHz()
+	}
+	if len(mhz) == 0 {
+		return 0, fmt.Errorf("no cpufreq: %w", errUnsupported)
+	}
+	switch s.Config.Measure {
+	case "avg_mhz", "":
+		return aggregate(mhz, "avg")
+	case "max_mhz":
+		return aggregate(mhz, "max")
+	case "min_mhz":
+		return aggregate(mhz, "min")
+	}
+	return 0, fmt.Errorf("unknown cpu_freq measure %q", s.Config.Measure)
+}
+
+// cpuinfoMHz returns the "cpu MHz" line of every core in /proc/cpuinfo.
+func cpuinfoMHz() []float64 {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return nil
+	}
+	var mhz []float64
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) != "cpu MHz" {
+			continue
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			mhz = append(mhz, v)
+		}
+	}
+	return mhz
+}
+
+// piThrottledFile is the firmware's throttle state on Raspberry Pi kernels
+// 5.x and later; older ones only have vcgencmd.
+const piThrottledFile = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+
+// cpuThrottled is 1 while the CPU is throttled. On a Raspberry Pi that is
+// the firmware's current under-voltage, frequency cap, throttling and soft
+// temperature limit flags. Elsewhere it is whether the thermal/power
+// throttle counters (Intel) went up since the previous sample.
+func (s *MetricState) cpuThrottled(ctx context.Context) (float64, error) {
+	if flags, ok := piThrottleFlags(ctx); ok {
+		if flags&0xf != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	files, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/*_throttle_count")
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no throttle state: %w", errUnsupported)
+	}
+	var total uint64
+	for _, f := range files {
+		if n, err := readSysFloat(f); err == nil {
+			total += uint64(n)
+		}
+	}
+	delta, _, err := s.counterDelta(total, s.now())
+	if err != nil || delta == 0 {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// piThrottleFlags reads the firmware's throttle bits, e.g. 0x50005.
+func piThrottleFlags(ctx context.Context) (uint64, bool) {
+	raw := readSysString(piThrottledFile)
+	if raw == "" {
+		path, err := exec.LookPath("vcgencmd")
+		if err != nil {
+			return 0, false
+		}
+		out, err := exec.CommandContext(ctx, path, "get_throttled").Output()
+		if err != nil {
+			return 0, false
+		}
+		// "throttled=0x50000"
+		_, raw, _ = strings.Cut(strings.TrimSpace(string(out)), "=")
+	}
+	flags, err := strconv.ParseUint(strings.TrimPrefix(raw, "0x"), 16, 64)
+	return flags, err == nil
+}
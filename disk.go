@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskValue reads one measure for the filesystem mounted at path.
+func diskValue(ctx context.Context, path, measure string) (float64, error) {
+	u, err := disk.UsageWithContext(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	switch measure {
+	case "percent_free":
+		return 100.0 - u.UsedPercent, nil
+	case "used_gb":
+		return float64(u.Used) / 1024 / 1024 / 1024, nil
+	case "free_gb":
+		return float64(u.Free) / 1024 / 1024 / 1024, nil
+	case "used_mb":
+		return float64(u.Used) / 1024 / 1024, nil
+	case "free_mb":
+		return float64(u.Free) / 1024 / 1024, nil
+	case "inodes_percent_used", "inodes_free":
+		// btrfs and some network filesystems allocate inodes dynamically
+		// and report none.
+		if u.InodesTotal == 0 {
+			return 0, fmt.Errorf("%s does not report inodes", path)
+		}
+		if measure == "inodes_free" {
+			return float64(u.InodesFree), nil
+		}
+		return u.InodesUsedPercent, nil
+	default:
+		return u.UsedPercent, nil
+	}
+}
+
+// deviceMountpoint finds where device is currently mounted. Symlinks such
+// as /dev/disk/by-uuid/... are resolved first, so stable names work too.
+func deviceMountpoint(ctx context.Context, device string) (string, error) {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	partitions, err := disk.PartitionsWithContext(ctx, true)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range partitions {
+		if p.Device == device {
+			return p.Mountpoint, nil
+		}
+	}
+	return "", fmt.Errorf("device %s is not mounted", device)
+}
+
+// diskPathsValue aggregates a measure over several filesystems. Paths that
+// can't be read (e.g. not mounted) are skipped so one missing mount doesn't
+// hide the rest; it only fails when none of them could be read.
+func diskPathsValue(ctx context.Context, paths []string, measure, how string) (float64, error) {
+	var vals []float64
+	var errs []error
+	for _, p := range paths {
+		v, err := diskValue(ctx, p, measure)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+			continue
+		}
+		vals = append(vals, v)
+	}
+	if len(vals) == 0 {
+		return 0, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		logDebugf("disk paths: skipping %v", err)
+	}
+	return aggregate(vals, how)
+}
+
+// aggregate reduces vals with max (default), min, sum or avg.
+func aggregate(vals []float64, how string) (float64, error) {
+	if len(vals) == 0 {
+		return 0, errors.New("nothing to aggregate")
+	}
+	out := vals[0]
+	switch how {
+	case "", "max":
+		for _, v := range vals[1:] {
+			out = max(out, v)
+		}
+	case "min":
+		for _, v := range vals[1:] {
+			out = min(out, v)
+		}
+	case "sum", "avg":
+		for _, v := range vals[1:] {
+			out += v
+		}
+		if how == "avg" {
+			out /= float64(len(vals))
+		}
+	default:
+		return 0, fmt.Errorf("unknown aggregate %q (want max, min, sum or avg)", how)
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskIOValue reads one disk_io measure: throughput in MB/s, operations
+// per second, or the share of time the device was busy. Like net_rate, the
+// first sample only sets the counter baseline.
+func (s *MetricState) diskIOValue(ctx context.Context) (float64, error) {
+	c, n, now, err := diskIOCounters(ctx, s.Config.Device)
+	if err != nil {
+		return 0, err
+	}
+
+	var raw uint64
+	switch s.Config.Measure {
+	case "write_mb_s":
+		raw = c.WriteBytes
+	case "read_iops":
+		raw = c.ReadCount
+	case "write_iops":
+		raw = c.WriteCount
+	case "iops":
+		raw = c.ReadCount + c.WriteCount
+	case "util_percent":
+		raw = c.IoTime
+	default:
+		raw = c.ReadBytes
+	}
+	if s.Config.Mode == "total" {
+		return float64(raw), nil
+	}
+
+	rate, err := s.counterRate(raw, now)
+	if err != nil {
+		return 0, err
+	}
+	switch s.Config.Measure {
+	case "read_iops", "write_iops", "iops":
+		return rate, nil
+	case "util_percent":
+		// io_ticks counts milliseconds with I/O in flight. The kernel
+		// updates it lazily, so a saturated device can read a little over
+		// 100% for one sample. Several devices are averaged.
+		return min(rate/10/float64(n), 100), nil
+	}
+	return rate / (1024 * 1024), nil
+}
+
+// diskIOCounters returns the counters for one block device ("sda",
+// "/dev/nvme0n1" or a /dev/disk/by-id/... link), the sum of those matching
+// a glob such as "nvme*", or the sum of all physical disks when device is
+// empty, along with the number of devices summed. Like netCounters, it
+// reads the current tick's shared snapshot and returns the tick's time.
+func diskIOCounters(ctx context.Context, device string) (disk.IOCountersStat, int, time.Time, error) {
+	t := currentTick()
+	all, err := t.diskCounters(ctx)
+	if err != nil {
+		return disk.IOCountersStat{}, 0, t.at, err
+	}
+	device = blockDeviceName(device)
+	if c, ok := all[device]; ok {
+		return c, 1, t.at, nil
+	}
+	if device != "" && !strings.ContainsAny(device, "*?[") {
+		return disk.IOCountersStat{}, 0, t.at, fmt.Errorf("block device %q not found", device)
+	}
+
+	sum := disk.IOCountersStat{Name: "all"}
+	n := 0
+	for name, c := range all {
+		if !diskIOMatch(device, name) {
+			continue
+		}
+		n++
+		sum.ReadCount += c.ReadCount
+		sum.WriteCount += c.WriteCount
+		sum.ReadBytes += c.ReadBytes
+		sum.WriteBytes += c.WriteBytes
+		sum.ReadTime += c.ReadTime
+		sum.WriteTime += c.WriteTime
+		sum.IoTime += c.IoTime
+	}
+	if n == 0 {
+		if device != "" {
+			return disk.IOCountersStat{}, 0, t.at, fmt.Errorf("no block device matches %q", device)
+		}
+		return disk.IOCountersStat{}, 0, t.at, fmt.Errorf("no physical disks: %w", errUnsupported)
+	}
+	return sum, n, t.at, nil
+}
+
+// blockDeviceName turns a device path into its kernel name, resolving
+// symlinks: "/dev/disk/by-id/nvme-..." -> "nvme0n1".
+func blockDeviceName(device string) string {
+	if strings.HasPrefix(device, "/") {
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+	}
+	return strings.TrimPrefix(device, "/dev/")
+}
+
+// diskIOMatch reports whether the block device name is selected by pattern.
+// Without a pattern only whole physical disks count: partitions, loop, md
+// and device-mapper devices would count the same I/O twice.
+func diskIOMatch(pattern, name string) bool {
+	if pattern != "" {
+		ok, _ := filepath.Match(pattern, name)
+		return ok
+	}
+	_, err := os.Stat(filepath.Join("/sys/block", name, "device"))
+	return err == nil
+}
+
+// diskIODevices lists the block devices selected by pattern, for per_device.
+func diskIODevices(pattern string) ([]string, error) {
+	all, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+	pattern = blockDeviceName(pattern)
+	var names []string
+	for _, name := range sortedKeys(all) {
+		if diskIOMatch(pattern, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
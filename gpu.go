@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// --- GPU Metrics (NVIDIA) ---
+//
+// Read through nvidia-smi, which ships with the driver and wraps NVML, so
+// there is no cgo or library to load here. One query per tick covers every
+// GPU and every gpu metric (see tickSnapshot).
+
+// gpuStat is one GPU's row. Fields the card doesn't report are absent from
+// values, so they fail the measure instead of reading 0.
+type gpuStat struct {
+	Index, UUID, Name string
+	values            map[string]float64 // By nvidia-smi query field
+}
+
+var gpuQueryFields = []string{"utilization.gpu", "memory.used", "memory.total", "temperature.gpu", "power.draw"}
+
+// queryGPUs runs nvidia-smi once for all GPUs.
+func queryGPUs(ctx context.Context) ([]gpuStat, error) {
+	path, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi not found: %w", errUnsupported)
+	}
+	query := "index,uuid,name," + strings.Join(gpuQueryFields, ",")
+	out, err := exec.CommandContext(ctx, path, "--query-gpu="+query, "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// No driver loaded, or no devices: the message is on stdout.
+			return nil, fmt.Errorf("nvidia-smi: %s", strings.TrimSpace(string(out)+string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	r := csv.NewReader(strings.NewReader(string(out)))
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing nvidia-smi output: %w", err)
+	}
+	var gpus []gpuStat
+	for _, row := range rows {
+		if len(row) != 3+len(gpuQueryFields) {
+			continue
+		}
+		g := gpuStat{Index: row[0], UUID: row[1], Name: row[2], values: map[string]float64{}}
+		for i, field := range gpuQueryFields {
+			// "[N/A]" and "[Not Supported]" are left out.
+			if v, err := strconv.ParseFloat(strings.TrimSpace(row[3+i]), 64); err == nil {
+				g.values[field] = v
+			}
+		}
+		gpus = append(gpus, g)
+	}
+	if len(gpus) == 0 {
+		return nil, fmt.Errorf("no GPUs: %w", errUnsupported)
+	}
+	return gpus, nil
+}
+
+// gpuValue reads one measure for the GPU selected by device (index or
+// UUID), or combines all GPUs by aggregate when device is empty.
+func gpuValue(ctx context.Context, device, measure, how string) (float64, error) {
+	gpus, err := currentTick().gpus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var vals []float64
+	for _, g := range gpus {
+		if device != "" && device != g.Index && !strings.EqualFold(device, g.UUID) {
+			continue
+		}
+		v, err := g.measure(measure)
+		if err != nil {
+			return 0, fmt.Errorf("GPU %s (%s): %w", g.Index, g.Name, err)
+		}
+		vals = append(vals, v)
+	}
+	if len(vals) == 0 {
+		return 0, fmt.Errorf("GPU %q not found", device)
+	}
+	return aggregate(vals, how)
+}
+
+func (g gpuStat) measure(measure string) (float64, error) {
+	field := map[string]string{
+		"":             "utilization.gpu",
+		"util_percent": "utilization.gpu",
+		"mem_used_mb":  "memory.used",
+		"temperature":  "temperature.gpu",
+		"power_w":      "power.draw",
+	}[measure]
+	if measure == "mem_percent" {
+		used, ok := g.values["memory.used"]
+		total, ok2 := g.values["memory.total"]
+		if !ok || !ok2 || total <= 0 {
+			return 0, fmt.Errorf("memory not reported")
+		}
+		return used / total * 100, nil
+	}
+	if field == "" {
+		return 0, fmt.Errorf("unknown gpu measure %q", measure)
+	}
+	v, ok := g.values[field]
+	if !ok {
+		return 0, fmt.Errorf("%s not supported", field)
+	}
+	return v, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- gRPC Broadcast Stream ---
+//
+// A server-streaming StatMonitor/Subscribe RPC and a unary GetCurrent
+// (proto/statmonitor.proto) served over HTTP/2 by net/http, so no gRPC
+// runtime is needed. Each subscriber gets the last broadcast of every
+// metric on connect, then every sample routed to the "grpc" sink.
+
+const (
+	grpcSubscribePath  = "/statmonitor.StatMonitor/Subscribe"
+	grpcGetCurrentPath = "/statmonitor.StatMonitor/GetCurrent"
+	grpcStreamBuffer   = 256 // Samples queued per subscriber before dropping
+)
+
+// gRPC status codes used here.
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+)
+
+// grpcBroadcasts is the "grpc" sink, set up when global.grpc_listen is set.
+var grpcBroadcasts *grpcSink
+
+type grpcSink struct {
+	mu   sync.Mutex
+	subs map[*grpcSubscriber]struct{}
+}
+
+type grpcSubscriber struct {
+	ch      chan Sample
+	names   map[string]bool // Empty means every metric
+	dropped int
+}
+
+func newGRPCSink() *grpcSink {
+	return &grpcSink{subs: make(map[*grpcSubscriber]struct{})}
+}
+
+func (g *grpcSink) Name() string { return "grpc" }
+
+// Send hands the sample to every subscriber without blocking; a subscriber
+// that can't keep up loses samples rather than stalling collection.
+func (g *grpcSink) Send(s Sample) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for sub := range g.subs {
+		if !sub.wants(s.Name) {
+			continue
+		}
+		select {
+		case sub.ch <- s:
+		default:
+			sub.dropped++
+		}
+	}
+	return nil
+}
+
+func (sub *grpcSubscriber) wants(name string) bool {
+	return len(sub.names) == 0 || sub.names[name]
+}
+
+func (g *grpcSink) subscribe(names []string) *grpcSubscriber {
+	sub := &grpcSubscriber{ch: make(chan Sample, grpcStreamBuffer), names: make(map[string]bool)}
+	for _, n := range names {
+		sub.names[n] = true
+	}
+	g.mu.Lock()
+	g.subs[sub] = struct{}{}
+	g.mu.Unlock()
+	return sub
+}
+
+func (g *grpcSink) unsubscribe(sub *grpcSubscriber) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.subs, sub)
+	return sub.dropped
+}
+
+func startGRPCServer(cfg *Config, states map[string]*MetricState) {
+	g := cfg.Global
+	mux := http.NewServeMux()
+	mux.HandleFunc(grpcSubscribePath, func(w http.ResponseWriter, r *http.Request) {
+		serveSubscribe(w, r, states)
+	})
+	mux.HandleFunc(grpcGetCurrentPath, func(w http.ResponseWriter, r *http.Request) {
+		serveGetCurrent(w, r, states)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		grpcStatus(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+	})
+
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Addr:      g.GRPCListen,
+		Handler:   requireAuth(mux, g.HTTPBearerToken, "", ""),
+		Protocols: &protocols,
+	}
+
+	go func() {
+		var err error
+		if g.HTTPTLSCert != "" && g.HTTPTLSKey != "" {
+			logInfof("gRPC (TLS) listening on %s", g.GRPCListen)
+			err = srv.ListenAndServeTLS(g.HTTPTLSCert, g.HTTPTLSKey)
+		} else {
+			logInfof("gRPC listening on %s", g.GRPCListen)
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			logErrorf("gRPC server stopped: %v", err)
+		}
+	}()
+}
+
+func serveSubscribe(w http.ResponseWriter, r *http.Request, states map[string]*MetricState) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC only", http.StatusUnsupportedMediaType)
+		return
+	}
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		grpcStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+	var names []string
+	err = protoFields(req, func(field, wire int, _ uint64, data []byte) {
+		if field == 1 && wire == wireBytes {
+			names = append(names, string(data))
+		}
+	})
+	if err != nil {
+		grpcStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+
+	// Subscribe before taking the snapshot so nothing broadcast in between
+	// is missed; at worst a sample arrives twice.
+	sub := grpcBroadcasts.subscribe(names)
+	defer func() {
+		if dropped := grpcBroadcasts.unsubscribe(sub); dropped > 0 {
+			logWarnf("gRPC subscriber %s was too slow, dropped %d samples", r.RemoteAddr, dropped)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	// Declared in Trailer above, so set after the body they go out as trailers.
+	defer w.Header().Set("Grpc-Status", fmt.Sprint(grpcOK))
+	rc := http.NewResponseController(w)
+
+	send := func(s Sample, snapshot bool) error {
+		if err := writeGRPCMessage(w, marshalSample(s, snapshot)); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	for _, s := range snapshotSamples(states) {
+		if !sub.wants(s.Name) {
+			continue
+		}
+		if err := send(s, true); err != nil {
+			return
+		}
+	}
+	logDebugf("gRPC subscriber %s connected", r.RemoteAddr)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			logDebugf("gRPC subscriber %s disconnected", r.RemoteAddr)
+			return
+		case s := <-sub.ch:
+			if err := send(s, false); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveGetCurrent answers the unary GetCurrent call from the value cache.
+func serveGetCurrent(w http.ResponseWriter, r *http.Request, states map[string]*MetricState) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC only", http.StatusUnsupportedMediaType)
+		return
+	}
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		grpcStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+	names := map[string]bool{}
+	err = protoFields(req, func(field, wire int, _ uint64, data []byte) {
+		if field == 1 && wire == wireBytes {
+			names[string(data)] = true
+		}
+	})
+	if err != nil {
+		grpcStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+
+	var resp []byte
+	now := time.Now()
+	statesMu.RLock()
+	for _, name := range sortedKeys(states) {
+		if len(names) > 0 && !names[name] {
+			continue
+		}
+		s := states[name]
+		var cur []byte
+		cur = appendString(cur, 1, s.Name)
+		cur = appendString(cur, 2, s.Config.Type)
+		if cv, ok := metricCache.get(s.Name); ok {
+			cur = appendBool(cur, 3, true)
+			cur = appendDouble(cur, 4, cv.Value)
+			cur = appendInt64(cur, 5, cv.Time.UnixNano())
+			cur = appendBool(cur, 6, metricCache.stale(cv, now))
+		}
+		cur = appendString(cur, 7, s.Config.unit())
+		status := metricCache.statusOf(s.Name)
+		cur = appendString(cur, 8, status.Severity)
+		if !status.LastBroadcast.IsZero() {
+			cur = appendDouble(cur, 9, status.LastValue)
+			cur = appendInt64(cur, 10, status.LastBroadcast.UnixNano())
+		}
+		cur = appendString(cur, 11, status.LastError)
+		resp = appendMessage(resp, 1, cur)
+	}
+	statesMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	writeGRPCMessage(w, resp)
+	w.Header().Set("Grpc-Status", fmt.Sprint(grpcOK))
+}
+
+// snapshotSamples is the last broadcast of every metric, in name order.
+func snapshotSamples(states map[string]*MetricState) []Sample {
+	statesMu.RLock()
+	defer statesMu.RUnlock()
+	var out []Sample
+	for _, name := range sortedKeys(states) {
+		s := states[name]
+		status := metricCache.statusOf(s.Name)
+		if !status.LastBroadcast.IsZero() {
+			out = append(out, Sample{
+				Name:      s.Name,
+				Value:     status.LastValue,
+				Time:      status.LastBroadcast,
+				Unit:      s.Config.unit(),
+				Severity:  status.Severity,
+				Threshold: s.Config.thresholdFor(status.Severity),
+				Label:     s.Config.boolLabel(status.LastValue),
+			})
+		}
+	}
+	return out
+}
+
+// readGRPCMessage reads one length-prefixed message from a request body.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF {
+			return nil, nil // No request message: same as an empty one
+		}
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+	if hdr[0] != 0 {
+		return nil, fmt.Errorf("compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > 1<<20 {
+		return nil, fmt.Errorf("request too large")
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+	return msg, nil
+}
+
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// grpcStatus ends a call that produced no messages ("Trailers-Only").
+func grpcStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Grpc-Status", fmt.Sprint(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", msg)
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- HTTP Status Endpoint ---
+
+type metricStatus struct {
+	Name          string     `json:"name"`
+	Type          string     `json:"type"`
+	Value         float64    `json:"value"`             // Last broadcast value
+	Current       *float64   `json:"current,omitempty"` // Last collected value, from the cache
+	AgeSeconds    *float64   `json:"age_seconds,omitempty"`
+	Stale         bool       `json:"stale,omitempty"`
+	LastBroadcast *time.Time `json:"last_broadcast,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+func startHTTPServer(cfg *Config, states map[string]*MetricState) {
+	g := cfg.Global
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshotStatus(states))
+	})
+	if wsBroadcasts != nil {
+		mux.HandleFunc(wsPath, func(w http.ResponseWriter, r *http.Request) {
+			serveWebSocket(w, r, states)
+		})
+	}
+
+	handler := requireAuth(mux, g.HTTPBearerToken, g.HTTPUsername, g.HTTPPassword)
+	srv := &http.Server{Addr: g.HTTPListen, Handler: handler}
+
+	go func() {
+		var err error
+		if g.HTTPTLSCert != "" && g.HTTPTLSKey != "" {
+			logInfof("HTTPS status listening on %s", g.HTTPListen)
+			err = srv.ListenAndServeTLS(g.HTTPTLSCert, g.HTTPTLSKey)
+		} else {
+			logInfof("HTTP status listening on %s", g.HTTPListen)
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			logErrorf("HTTP server stopped: %v", err)
+		}
+	}()
+}
+
+// requireAuth accepts either a matching bearer token or matching basic-auth
+// credentials, whichever are configured. With neither configured the
+// endpoints stay open, which is only sensible on localhost.
+func requireAuth(next http.Handler, token, user, pass string) http.Handler {
+	if token == "" && user == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if user != "" {
+			u, p, ok := r.BasicAuth()
+			if ok && subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(p), []byte(pass)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="stat-monitor"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func snapshotStatus(states map[string]*MetricState) []metricStatus {
+	now := time.Now()
+	statesMu.RLock()
+	defer statesMu.RUnlock()
+	out := make([]metricStatus, 0, len(states))
+	for _, s := range states {
+		status := metricCache.statusOf(s.Name)
+		st := metricStatus{
+			Name:      s.Name,
+			Type:      s.Config.Type,
+			Value:     status.LastValue,
+			LastError: status.LastError,
+		}
+		if !status.LastBroadcast.IsZero() {
+			st.LastBroadcast = &status.LastBroadcast
+		}
+		if !status.LastErrorTime.IsZero() {
+			st.LastErrorTime = &status.LastErrorTime
+		}
+
+		if cv, ok := metricCache.get(s.Name); ok {
+			v, age := cv.Value, cv.age(now).Seconds()
+			st.Current = &v
+			st.AgeSeconds = &age
+			st.Stale = metricCache.stale(cv, now)
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
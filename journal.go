@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalPriorities are syslog's levels as journalctl -p names them.
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// journalRateValue counts journal entries at priority or above (default
+// err) logged since the previous sample, optionally for one unit. count is
+// the number of entries, per_minute the same scaled by the sample interval.
+// The first sample only sets the starting point.
+func (s *MetricState) journalRateValue(ctx context.Context) (float64, error) {
+	priority := s.Config.Priority
+	if priority == "" {
+		priority = "err"
+	}
+	if n, err := strconv.Atoi(priority); err == nil && n >= 0 && n < len(journalPriorities) {
+		priority = journalPriorities[n]
+	}
+	known := false
+	for _, p := range journalPriorities {
+		known = known || p == priority
+	}
+	if !known {
+		return 0, fmt.Errorf("unknown priority %q (%s or 0-7)", s.Config.Priority, strings.Join(journalPriorities, ", "))
+	}
+
+	now := s.now()
+	since := s.LastTime
+	if since.IsZero() {
+		s.LastTime = now
+		return 0, errNotReady
+	}
+	n, err := countJournal(ctx, since, now, priority, s.Config.Service)
+	if err != nil {
+		return 0, err
+	}
+	s.LastTime = now
+
+	switch s.Config.Measure {
+	case "count", "":
+		return float64(n), nil
+	case "per_minute":
+		return float64(n) / now.Sub(since).Minutes(), nil
+	}
+	return 0, fmt.Errorf("unknown journal_rate measure %q", s.Config.Measure)
+}
+
+// countJournal counts entries logged in (since, until]. journalctl's
+// --since only has second resolution, so the exact window is applied to
+// each entry's own timestamp.
+func countJournal(ctx context.Context, since, until time.Time, priority, unit string) (int, error) {
+	path, err := exec.LookPath("journalctl")
+	if err != nil {
+		return 0, fmt.Errorf("no journalctl: %w", errUnsupported)
+	}
+	args := []string{
+		"--quiet", "--no-pager", "--output=json", "--output-fields=PRIORITY",
+		"--priority=" + priority,
+		"--since=@" + strconv.FormatInt(since.Unix(), 10),
+		"--until=@" + strconv.FormatInt(until.Unix()+1, 10),
+	}
+	if unit != "" {
+		args = append(args, "--unit="+unit)
+	}
+	out, err := exec.CommandContext(ctx, path, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return 0, fmt.Errorf("journalctl: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("journalctl: %w", err)
+	}
+
+	from, to := since.UnixMicro(), until.UnixMicro()
+	n := 0
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var entry struct {
+			Realtime string `json:"__REALTIME_TIMESTAMP"`
+		}
+		if json.Unmarshal(sc.Bytes(), &entry) != nil {
+			continue
+		}
+		if t, err := strconv.ParseInt(entry.Realtime, 10, 64); err == nil && t > from && t <= to {
+			n++
+		}
+	}
+	return n, sc.Err()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// --- Kernel Counters (/proc) ---
+
+const conntrackDir = "/proc/sys/net/netfilter/"
+
+// conntrackValue reports netfilter connection tracking table usage.
+func conntrackValue(measure string) (float64, error) {
+	count, err := readSysFloat(conntrackDir + "nf_conntrack_count")
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("nf_conntrack not loaded: %w", errUnsupported)
+	}
+	if err != nil {
+		return 0, err
+	}
+	max, err := readSysFloat(conntrackDir + "nf_conntrack_max")
+	if err != nil {
+		return 0, err
+	}
+
+	switch measure {
+	case "count", "":
+		return count, nil
+	case "max":
+		return max, nil
+	case "percent_used":
+		if max <= 0 {
+			return 0, fmt.Errorf("nf_conntrack_max is %v", max)
+		}
+		return count / max * 100, nil
+	}
+	return 0, fmt.Errorf("unknown conntrack measure %q", measure)
+}
+
+// entropyValue is the kernel's available entropy in bits.
+func entropyValue() (float64, error) {
+	v, err := readSysFloat("/proc/sys/kernel/random/entropy_avail")
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("no entropy_avail: %w", errUnsupported)
+	}
+	return v, err
+}
+
+// fdValue reports system-wide file handles from /proc/sys/fs/file-nr,
+// which holds "allocated unused max".
+func fdValue(measure string) (float64, error) {
+	b, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("no file-nr: %w", errUnsupported)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var allocated, unused, max float64
+	if _, err := fmt.Sscanf(string(b), "%f %f %f", &allocated, &unused, &max); err != nil {
+		return 0, fmt.Errorf("parse file-nr: %w", err)
+	}
+	used := allocated - unused
+
+	switch measure {
+	case "used", "":
+		return used, nil
+	case "max":
+		return max, nil
+	case "percent_used":
+		if max <= 0 {
+			return 0, fmt.Errorf("file-max is %v", max)
+		}
+		return used / max * 100, nil
+	}
+	return 0, fmt.Errorf("unknown fd measure %q", measure)
+}
+
+// swapRateValue is the rate of pages swapped in or out since the previous
+// sample, from /proc/vmstat, in pages/s or MB/s. Sustained swap-in is
+// thrashing; used swap on its own is often just idle pages parked there.
+// With mode total it is the lifetime count, in pages or MB.
+func (s *MetricState) swapRateValue() (float64, error) {
+	counter := "pswpin"
+	if strings.HasPrefix(s.Config.Measure, "out_") {
+		counter = "pswpout"
+	}
+	pages, err := vmstatCounter(counter)
+	if err != nil {
+		return 0, err
+	}
+	value := float64(pages)
+	if s.Config.Mode != "total" {
+		if value, err = s.counterRate(pages, s.now()); err != nil {
+			return 0, err
+		}
+	}
+	if strings.HasSuffix(s.Config.Measure, "_pages_s") {
+		return value, nil
+	}
+	return value * float64(os.Getpagesize()) / (1024 * 1024), nil
+}
+
+// sysRateValue is the rate of context switches (default), interrupts or
+// forks per second since the previous sample, from /proc/stat. With mode
+// total it is the count since boot.
+func (s *MetricState) sysRateValue() (float64, error) {
+	key := map[string]string{
+		"":                 "ctxt",
+		"context_switches": "ctxt",
+		"interrupts":       "intr",
+		"forks":            "processes",
+	}[s.Config.Measure]
+	if key == "" {
+		return 0, fmt.Errorf("unknown sys_rate measure %q", s.Config.Measure)
+	}
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		// "intr" is followed by per-IRQ counts; the first is the total.
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != key {
+			continue
+		}
+		total, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse /proc/stat %s: %w", key, err)
+		}
+		if s.Config.Mode == "total" {
+			return float64(total), nil
+		}
+		return s.counterRate(total, s.now())
+	}
+	return 0, fmt.Errorf("no %s in /proc/stat: %w", key, errUnsupported)
+}
+
+// vmstatCounter reads one counter from /proc/vmstat.
+func vmstatCounter(name string) (uint64, error) {
+	b, err := os.ReadFile("/proc/vmstat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, name+" "); ok {
+			return strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no %s in /proc/vmstat: %w", name, errUnsupported)
+}
+
+// loadValue reads the 1, 5 (default) or 15 minute load average. normalized
+// divides it by the number of logical cores, so 1.0 means fully loaded on
+// any machine.
+func loadValue(ctx context.Context, measure string, normalized bool) (float64, error) {
+	l, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var v float64
+	switch measure {
+	case "load1":
+		v = l.Load1
+	case "load5", "":
+		v = l.Load5
+	case "load15":
+		v = l.Load15
+	default:
+		return 0, fmt.Errorf("unknown load measure %q (load1, load5 or load15)", measure)
+	}
+	if normalized {
+		cores, err := cpu.CountsWithContext(ctx, true)
+		if err != nil || cores <= 0 {
+			cores = runtime.NumCPU()
+		}
+		v /= float64(cores)
+	}
+	return v, nil
+}
+
+// psiValue reads Pressure Stall Information from /proc/pressure/<resource>.
+// measure is "<some|full>_<avg10|avg60|avg300>", e.g. "some_avg10".
+func psiValue(resource, measure string) (float64, error) {
+	switch resource {
+	case "cpu", "io", "memory":
+	default:
+		return 0, fmt.Errorf("psi resource must be cpu, io or memory, got %q", resource)
+	}
+	if measure == "" {
+		measure = "some_avg10"
+	}
+	kind, field, ok := strings.Cut(measure, "_")
+	if !ok || (kind != "some" && kind != "full") {
+		return 0, fmt.Errorf("unknown psi measure %q", measure)
+	}
+
+	b, err := os.ReadFile("/proc/pressure/" + resource)
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("kernel without PSI: %w", errUnsupported)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Lines look like: some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != kind {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(f, field+"="); ok {
+				return strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("psi %s: %s not reported", resource, measure)
+}
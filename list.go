@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// --- List Mode (-list) ---
+
+// listMetrics prints every metric the daemon would monitor, after
+// auto-discovery expansion, with one sampled value or the error. Rate
+// metrics need two samples, so those are read again after a short pause.
+func listMetrics(w io.Writer, states map[string]*MetricState, timeout time.Duration) {
+	results := map[string]string{}
+	var pending []string
+
+	sample := func(name string) error {
+		s := states[name]
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		val, err := getValue(ctx, s)
+		cancel()
+		if err == nil {
+			val, err = s.Config.plausible(val)
+		}
+		if err != nil {
+			results[name] = "ERROR: " + err.Error()
+			return err
+		}
+		results[name] = strconv.FormatFloat(val, 'f', 2, 64)
+		if u := s.Config.unit(); u != "" {
+			results[name] += " " + u
+		}
+		return nil
+	}
+
+	names := sortedKeys(states)
+	for _, name := range names {
+		if errors.Is(sample(name), errNotReady) {
+			pending = append(pending, name)
+		}
+	}
+	if len(pending) > 0 {
+		time.Sleep(1 * time.Second)
+		for _, name := range pending {
+			if errors.Is(sample(name), errNotReady) {
+				results[name] = "(no value yet)"
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tMEASURE\tTARGET\tDIFF\tINTERVAL\tRESEND\tVALUE")
+	for _, name := range names {
+		c := states[name].Config
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%g\t%s\t%s\t%s\n",
+			name, c.Type, orDash(c.Measure), orDash(c.target()), c.Diff, c.Interval, c.ResendInterval, results[name])
+	}
+	tw.Flush()
+}
+
+// target is the thing a metric watches (path, interface, unit, ...).
+func (c MetricConfig) target() string {
+	parts := append([]string(nil), c.Paths...)
+	for _, p := range []string{c.Path, c.Device, c.Interface, c.Service, c.Battery, c.Container, c.Label} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if c.Host != "" {
+		parts = append(parts, fmt.Sprintf("%s:%d", c.Host, c.Port))
+	}
+	return strings.Join(parts, " ")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// --- Leveled Logging ---
+//
+// Diagnostic output goes through these helpers and is filtered by
+// global.log_level. Broadcast lines are written by the log sink and are
+// not subject to the level (see global.log_broadcasts).
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var currentLogLevel = levelInfo
+
+func setLogLevel(name string) error {
+	switch strings.ToLower(name) {
+	case "debug":
+		currentLogLevel = levelDebug
+	case "info", "":
+		currentLogLevel = levelInfo
+	case "warn", "warning":
+		currentLogLevel = levelWarn
+	case "error":
+		currentLogLevel = levelError
+	default:
+		return fmt.Errorf("unknown log_level %q", name)
+	}
+	return nil
+}
+
+func logAt(level logLevel, prefix, format string, args ...any) {
+	if level < currentLogLevel {
+		return
+	}
+	log.Print(prefix + fmt.Sprintf(format, args...))
+}
+
+func logDebugf(format string, args ...any) { logAt(levelDebug, "[DEBUG] ", format, args...) }
+func logInfof(format string, args ...any)  { logAt(levelInfo, "", format, args...) }
+func logWarnf(format string, args ...any)  { logAt(levelWarn, "[WARN] ", format, args...) }
+func logErrorf(format string, args ...any) { logAt(levelError, "[ERROR] ", format, args...) }
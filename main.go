@@ -1,21 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
-	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 	"gopkg.in/yaml.v3"
@@ -24,19 +33,90 @@ import (
 // --- Configuration ---
 
 type MetricConfig struct {
-	Type           string        `yaml:"type"`    // disk, disk_auto, service, net_rate, cpu, mem, swap
-	Path           string        `yaml:"path"`    // for disk
-	Measure        string        `yaml:"measure"` // percent_used, free_gb, rx_mbps, etc.
-	Service        string        `yaml:"service"` // for systemd
-	Diff           float64       `yaml:"diff"`
-	Interval       time.Duration `yaml:"interval"`
-	ResendInterval time.Duration `yaml:"resend_interval"`
+	Type              string        `yaml:"type"`          // disk, disk_auto, service, net_rate, net_auto, cpu, mem, swap, procs, battery, conntrack, entropy, fd, psi, container, container_auto, tcp_check, temp, disk_io, process, gpu, net_conn, cpu_freq, sys_rate, systemd_failed, journal_rate, smart, zfs
+	Path              string        `yaml:"path"`          // for disk
+	Paths             []string      `yaml:"paths"`         // for disk: several mountpoints reduced by Aggregate
+	Aggregate         string        `yaml:"aggregate"`     // for disk paths and gpu: max (default), min, sum, avg; for temp: max, min, avg
+	Device            string        `yaml:"device"`        // for disk: e.g. "/dev/sda1", used wherever it is mounted; for disk_io: name or glob, e.g. "nvme*"; for gpu: index or UUID; for smart: e.g. "/dev/sda"
+	PerDevice         bool          `yaml:"per_device"`    // for disk_io: one metric per block device matching `device`; for gpu: one per GPU; for smart: one per disk smartctl finds; for zfs: one per pool
+	Measure           string        `yaml:"measure"`       // percent_used, free_gb, rx_mbps, etc.
+	Service           string        `yaml:"service"`       // for systemd; for systemd_failed: optional unit glob, e.g. "*.service"; for journal_rate: optional unit
+	Interface         string        `yaml:"interface"`     // for net_rate: name or glob (summed); empty means all interfaces combined
+	PerInterface      bool          `yaml:"per_interface"` // for net_rate: one metric per interface matching `interface`, like net_auto
+	Mode              string        `yaml:"mode"`          // For counter metrics: rate (default, change since last sample) or total (raw counter)
+	Host              string        `yaml:"host"`          // for tcp_check
+	Battery           string        `yaml:"battery"`       // for battery, e.g. "BAT0"; empty picks the first
+	Sensor            string        `yaml:"sensor"`        // for temp: sensor key glob, e.g. "coretemp_package_id_*"; empty means all
+	Process           string        `yaml:"process"`       // for process and fd: name, e.g. "nginx"
+	Pattern           string        `yaml:"pattern"`       // for process and fd: regex over the command line
+	PidFile           string        `yaml:"pidfile"`       // for process and fd: read the PID from this file
+	Container         string        `yaml:"container"`     // for container: name or ID
+	Label             string        `yaml:"label"`         // for container/container_auto: "key=value" filter
+	CoreInclude       string        `yaml:"core_include"`  // for cpu per_core: e.g. "0-3,8"; empty means all
+	CoreStep          int           `yaml:"core_step"`     // for cpu per_core: keep every Nth selected core
+	Normalized        bool          `yaml:"normalized"`    // for load: divide by the number of cores
+	Resource          string        `yaml:"resource"`      // for psi: cpu, io, memory
+	Pool              string        `yaml:"pool"`          // for zfs: pool name; empty means the worst of all pools
+	Priority          string        `yaml:"priority"`      // for journal_rate: lowest priority counted, e.g. "err" (default) or 3
+	Period            string        `yaml:"period"`        // for net_quota: daily or monthly (default)
+	LimitGB           float64       `yaml:"limit_gb"`      // for net_quota used_percent
+	Port              int           `yaml:"port"`          // for tcp_check; for net_conn: only sockets on this local port
+	Diff              float64       `yaml:"diff"`
+	DiffPercent       float64       `yaml:"diff_percent"`   // Relative change vs last broadcast, in %
+	DiffDirection     string        `yaml:"diff_direction"` // up, down, or both (default)
+	Invert            bool          `yaml:"invert"`         // Report 1 - value, for 0/1 metrics like service or reachable
+	Scale             float64       `yaml:"scale"`          // Multiplier applied to the collected value (0 = unset)
+	Offset            float64       `yaml:"offset"`         // Added after Scale
+	Deadband          float64       `yaml:"deadband"`       // Values with magnitude below this are reported as 0
+	Tolerance         float64       `yaml:"tolerance"`      // Slack on plausibility bounds before a reading is rejected (default 0.5)
+	Interval          time.Duration `yaml:"interval"`
+	ResendInterval    time.Duration `yaml:"resend_interval"`
+	MaxResendInterval time.Duration `yaml:"max_resend_interval"` // Let steady metrics stretch the heartbeat up to this
+	MaxBroadcastRate  time.Duration `yaml:"max_broadcast_rate"`  // At most one non-heartbeat broadcast per this duration
+
+	SuppressInitial *bool    `yaml:"suppress_initial"` // Overrides global.suppress_initial
+	Sinks           []string `yaml:"sinks"`            // Sink names to send to; empty means all sinks
+
+	Warn            *float64 `yaml:"warn"` // Severity thresholds; value >= threshold by default
+	Crit            *float64 `yaml:"crit"`
+	ThresholdBelow  bool     `yaml:"threshold_below"`  // Thresholds fire when value <= threshold (e.g. free space)
+	Unit            string   `yaml:"unit"`             // Overrides the unit derived from type/measure
+	MessageTemplate string   `yaml:"message_template"` // text/template for human-readable broadcasts
+	BoolFormat      string   `yaml:"bool_format"`      // Text for 0/1 metrics as "<on>/<off>", e.g. "up/down"
+
+	OnWarn         string        `yaml:"on_warn"`         // Shell command run when the metric enters warn
+	OnCrit         string        `yaml:"on_crit"`         // Shell command run when the metric enters crit
+	ActionCooldown time.Duration `yaml:"action_cooldown"` // Minimum gap between runs of the same action (default 5m)
+
+	Schedule ScheduleConfig `yaml:"schedule"` // Quiet hours: only crit values and heartbeats are broadcast
+
+	For           time.Duration `yaml:"for"`            // Threshold must hold this long before warn/crit takes effect
+	EscalateAfter time.Duration `yaml:"escalate_after"` // Emit an "escalated" event once warn/crit has lasted this long
 }
 
 type Config struct {
 	Global struct {
-		CheckFrequency time.Duration `yaml:"check_frequency"`
+		CheckFrequency     time.Duration    `yaml:"check_frequency"`
+		CollectTimeout     time.Duration    `yaml:"collect_timeout"` // Deadline for a single collection, passed down as a context
+		HTTPListen         string           `yaml:"http_listen"`     // e.g. "127.0.0.1:9100", empty disables /status
+		HTTPTLSCert        string           `yaml:"http_tls_cert"`   // Serve HTTPS when cert and key are set
+		HTTPTLSKey         string           `yaml:"http_tls_key"`
+		HTTPBearerToken    string           `yaml:"http_bearer_token"` // Require "Authorization: Bearer <token>"
+		HTTPUsername       string           `yaml:"http_username"`     // Require basic auth
+		HTTPPassword       string           `yaml:"http_password"`
+		HTTPWebSocket      bool             `yaml:"http_websocket"`      // Also stream broadcasts at /ws on http_listen
+		GRPCListen         string           `yaml:"grpc_listen"`         // e.g. "127.0.0.1:9101", serves the gRPC broadcast stream
+		SuppressInitial    bool             `yaml:"suppress_initial"`    // Seed baselines on startup without broadcasting
+		LogLevel           string           `yaml:"log_level"`           // debug, info (default), warn, error
+		LogBroadcasts      *bool            `yaml:"log_broadcasts"`      // Older form of outputs.log.enabled
+		SummaryInterval    time.Duration    `yaml:"summary_interval"`    // Periodic "summary" broadcast of all values; 0 disables
+		CacheTTL           time.Duration    `yaml:"cache_ttl"`           // Collected values older than this are reported as stale; 0 disables
+		RediscoverInterval time.Duration    `yaml:"rediscover_interval"` // Re-run container_auto discovery; 0 disables
+		StateFile          string           `yaml:"state_file"`          // Where accumulating metrics (net_quota) and open incidents persist across restarts
+		OutputFile         FileOutputConfig `yaml:"output_file"`         // Older form of outputs.file
+		Retry              RetryConfig      `yaml:"retry"`               // Delivery retries for remote sinks
 	} `yaml:"global"`
+	Outputs OutputsConfig           `yaml:"outputs"`
 	Metrics map[string]MetricConfig `yaml:"metrics"`
 }
 
@@ -50,39 +130,176 @@ type MetricState struct {
 	LastBroadcast time.Time
 	FirstRun      bool
 
-	LastRawCounter uint64 // For calculating network rates
+	LastRawCounter  uint64         // Previous counter sample (see counterDelta)
+	LastCPUTimes    *cpu.TimesStat // For iowait/steal deltas
+	EffectiveResend time.Duration  // Current heartbeat period (see max_resend_interval)
+	quota           *quotaState    // net_quota accumulator, mirrored to the state file
+	ContainerID     string         // Resolved container for container metrics
+
+	procCPU map[int32]float64 // CPU seconds per PID at the last sample, for process cpu_percent
+
+	Source string // Config key an auto-discovered state came from (rediscovery, Prometheus names)
+
+	Disabled      bool   // Set when the collector returned errUnsupported
+	Failing       bool   // Last collection failed; flips emit error/recovered events
+	LastError     string // Empty when the last collection succeeded
+	LastErrorTime time.Time
+
+	Severity   string               // Last evaluated severity, for on_warn/on_crit transitions
+	lastAction map[string]time.Time // Last run of each action by severity
+	warnSince  time.Time            // Start of the current warn breach, for `for`
+	critSince  time.Time            // Start of the current crit breach
+	escalated  bool                 // "escalated" already sent for this episode
+
+	// collecting is held for a whole collection, so a collector running
+	// past the next tick keeps the state to itself; mu is only held while
+	// the result is applied. Readers use the status published to
+	// metricCache and take neither.
+	collecting sync.Mutex
+	mu         sync.Mutex
+
+	tmpl     *template.Template // Parsed MessageTemplate, nil for the default format
+	clock    Clock              // Time source for throttling and rate math
+	schedule *schedule          // Parsed Schedule, nil without quiet hours
+}
+
+func newMetricState(name string, config MetricConfig) *MetricState {
+	s := &MetricState{Name: name, Config: config, FirstRun: true, Severity: "ok", clock: realClock{}}
+	if config.MessageTemplate != "" {
+		t, err := template.New(name).Parse(config.MessageTemplate)
+		if err != nil {
+			logWarnf("metric %s: bad message_template, using default format: %v", name, err)
+		} else {
+			s.tmpl = t
+		}
+	}
+	if config.BoolFormat != "" && (!config.boolean() || !strings.Contains(config.BoolFormat, "/")) {
+		logWarnf("metric %s: bool_format needs a 0/1 metric and \"<on>/<off>\", showing numbers", name)
+	}
+	sc, err := parseSchedule(config.Schedule)
+	if err != nil {
+		logWarnf("metric %s: bad schedule, ignoring quiet hours: %v", name, err)
+	}
+	s.schedule = sc
+	return s
 }
 
-// CheckAndBroadcast decides if a broadcast is needed.
-func (s *MetricState) CheckAndBroadcast(currentValue float64) {
-	now := time.Now()
+// errUnsupported marks a collector that can never work on this host (no
+// battery, kernel feature missing, ...). The metric is disabled after
+// logging once instead of erroring every tick.
+var errUnsupported = errors.New("not supported on this system")
 
-	// 1. First Run: Always broadcast immediately on startup
+// errNotReady is returned by collectors that need more than one sample
+// (e.g. rates) before they can produce a value. It is not a real failure.
+var errNotReady = errors.New("collecting baseline")
+
+// CheckAndBroadcast decides if a broadcast is needed and reports whether
+// one was sent.
+func (s *MetricState) CheckAndBroadcast(currentValue float64) bool {
+	now := s.now()
+
+	// 1. First Run: Broadcast immediately on startup, unless suppressed,
+	// in which case the value only becomes the baseline for diff/heartbeat.
 	if s.FirstRun {
 		s.FirstRun = false
 		s.updateState(currentValue, now)
-		broadcast(s.Name, currentValue)
-		return
+		if s.Config.SuppressInitial == nil || !*s.Config.SuppressInitial {
+			s.broadcast(currentValue)
+			return true
+		}
+		return false
 	}
 
 	timeSinceLast := now.Sub(s.LastBroadcast)
 
 	// 2. Heartbeat (Resend Interval)
-	if timeSinceLast >= s.Config.ResendInterval {
+	if timeSinceLast >= s.resendInterval(currentValue) {
 		s.updateState(currentValue, now)
-		broadcast(s.Name, currentValue)
-		return
+		s.broadcast(currentValue)
+		s.extendResend()
+		return true
 	}
 
-	// 3. Throttle (Interval) & Diff
+	// 3. Hard rate limit: nothing but the heartbeat gets through more often
+	// than once per MaxBroadcastRate, however fast the value is moving.
+	if timeSinceLast < s.Config.MaxBroadcastRate {
+		return false
+	}
+
+	// 4. Quiet hours: hold back everything short of crit. The state isn't
+	// updated, so a change is still broadcast once the window ends.
+	if s.heldQuiet(s.Severity) {
+		return false
+	}
+
+	// 5. Throttle (Interval) & Diff
 	if timeSinceLast >= s.Config.Interval {
-		diff := math.Abs(currentValue - s.LastValue)
-		if diff >= s.Config.Diff {
+		if s.diffExceeded(currentValue) {
 			s.updateState(currentValue, now)
-			broadcast(s.Name, currentValue)
-			return
+			s.broadcast(currentValue)
+			return true
 		}
 	}
+	return false
+}
+
+// diffExceeded checks the absolute (Diff) and relative (DiffPercent)
+// thresholds; either one triggering is enough. With only diff_percent set,
+// the absolute check is skipped so its zero default doesn't fire every time.
+func (s *MetricState) diffExceeded(currentValue float64) bool {
+	// Ignore changes in the direction the user considers benign.
+	switch s.Config.DiffDirection {
+	case "up":
+		if currentValue < s.LastValue {
+			return false
+		}
+	case "down":
+		if currentValue > s.LastValue {
+			return false
+		}
+	}
+
+	diff := math.Abs(currentValue - s.LastValue)
+
+	if s.Config.DiffPercent > 0 {
+		// No meaningful relative change from zero: any movement counts.
+		if s.LastValue == 0 {
+			if diff > 0 {
+				return true
+			}
+		} else if diff/math.Abs(s.LastValue)*100 >= s.Config.DiffPercent {
+			return true
+		}
+		if s.Config.Diff == 0 {
+			return false
+		}
+	}
+
+	return diff >= s.Config.Diff
+}
+
+// resendInterval is the heartbeat period. With max_resend_interval set, a
+// metric whose value stays within Diff of the last broadcast doubles its
+// period after each heartbeat, up to the max, and drops back to
+// resend_interval as soon as the value moves.
+func (s *MetricState) resendInterval(currentValue float64) time.Duration {
+	base, max := s.Config.ResendInterval, s.Config.MaxResendInterval
+	if max <= base {
+		return base
+	}
+	steady := math.Abs(currentValue-s.LastValue) < s.Config.Diff || currentValue == s.LastValue
+	if !steady || s.EffectiveResend < base {
+		s.EffectiveResend = base
+	}
+	return s.EffectiveResend
+}
+
+// extendResend is called after a heartbeat while steady.
+func (s *MetricState) extendResend() {
+	if s.Config.MaxResendInterval <= s.Config.ResendInterval {
+		return
+	}
+	s.EffectiveResend = min(s.EffectiveResend*2, s.Config.MaxResendInterval)
 }
 
 func (s *MetricState) updateState(val float64, t time.Time) {
@@ -93,40 +310,105 @@ func (s *MetricState) updateState(val float64, t time.Time) {
 // --- Main Loop ---
 
 func main() {
-	configFile := flag.String("config", "config.yaml", "Path to configuration file")
+	configFile := flag.String("config", "config.yaml", "Path to configuration file, \"-\" for stdin, or \"\" to read SM_* environment variables")
+	listOnly := flag.Bool("list", false, "Print every metric (after auto-discovery) with one sampled value, then exit")
+	testOnly := flag.Bool("test-sinks", false, "Send one test broadcast through every configured sink, report per-sink results, then exit")
 	flag.Parse()
 
 	cfg, err := loadConfig(*configFile)
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
 	}
+	if err := setLogLevel(cfg.Global.LogLevel); err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	metricCache.ttl = cfg.Global.CacheTTL
+	if cfg.Global.StateFile != "" {
+		if err := persisted.load(cfg.Global.StateFile); err != nil {
+			logErrorf("reading state file, starting fresh: %v", err)
+		}
+	}
+
+	// Set up Sinks (before states, so sink self metrics get registered)
+	sinks = setupSinks(cfg)
+
+	if *testOnly {
+		if testSinks(os.Stdout, sinks) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize States
 	states := initializeStates(cfg)
+	registerCollectTimers(states)
+	addSelfStates(states)
+	validateSinkRoutes(states)
+
+	if *listOnly {
+		listMetrics(os.Stdout, states, cfg.Global.CollectTimeout)
+		return
+	}
 
 	// Set up Ticker
 	ticker := time.NewTicker(cfg.Global.CheckFrequency)
 	defer ticker.Stop()
 
+	// Optional periodic rollup of all values; a nil channel never fires.
+	var summaryC <-chan time.Time
+	if cfg.Global.SummaryInterval > 0 {
+		summaryTicker := time.NewTicker(cfg.Global.SummaryInterval)
+		defer summaryTicker.Stop()
+		summaryC = summaryTicker.C
+	}
+
+	var rediscoverC <-chan time.Time
+	if cfg.Global.RediscoverInterval > 0 {
+		rediscoverTicker := time.NewTicker(cfg.Global.RediscoverInterval)
+		defer rediscoverTicker.Stop()
+		rediscoverC = rediscoverTicker.C
+	}
+
 	// Set up Signal Handling
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	log.Println("Service started. Watching metrics...")
+	if cfg.Global.HTTPListen != "" {
+		startHTTPServer(cfg, states)
+	}
+	if cfg.Global.GRPCListen != "" {
+		startGRPCServer(cfg, states)
+	}
+	if p := cfg.Outputs.Prometheus; p.enabled() && p.Listen != "" {
+		startPrometheusServer(cfg, states)
+	}
+
+	logDebugf("Service started. Watching metrics...")
 
 	// --- CHANGE: Immediate First Run ---
 	// We run this ONCE before the ticker starts to ensure logs appear
 	// instantly on system boot, rather than waiting 1 second.
-	log.Println("Broadcasting initial baseline stats...")
-	collectAndProcess(states)
+	logDebugf("Broadcasting initial baseline stats...")
+	collectInOrder(states, cfg.Global.CollectTimeout)
 
 	for {
 		select {
-		case <-sigs:
-			log.Println("Shutting down...")
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				logInfof("Reopening output files...")
+				reopenSinks()
+				continue
+			}
+			logInfof("Shutting down...")
+			persisted.flush()
 			return
 		case <-ticker.C:
-			collectAndProcess(states)
+			collectAndProcess(states, cfg.Global.CollectTimeout)
+		case <-summaryC:
+			broadcastSummary(states)
+		case <-rediscoverC:
+			reconcileStates(cfg, states)
 		}
 	}
 }
@@ -136,12 +418,17 @@ func main() {
 func initializeStates(cfg *Config) map[string]*MetricState {
 	states := make(map[string]*MetricState)
 
-	for key, config := range cfg.Metrics {
+	for _, key := range sortedKeys(cfg.Metrics) {
+		config := cfg.Metrics[key]
+		if config.SuppressInitial == nil {
+			config.SuppressInitial = &cfg.Global.SuppressInitial
+		}
+
 		// DYNAMIC DISK
 		if config.Type == "disk_auto" {
 			partitions, err := disk.Partitions(false)
 			if err != nil {
-				log.Printf("Error detecting partitions: %v", err)
+				logErrorf("detecting partitions: %v", err)
 				continue
 			}
 			for _, p := range partitions {
@@ -153,174 +440,818 @@ func initializeStates(cfg *Config) map[string]*MetricState {
 					name := fmt.Sprintf("%s%s", key, cleanMount)
 					c := config
 					c.Path = p.Mountpoint
-					states[name] = &MetricState{Name: name, Config: c, FirstRun: true}
-					log.Printf("Discovered disk: %s -> %s", p.Mountpoint, name)
+					states[name] = newMetricState(name, c)
+					states[name].Source = key
+					logDebugf("Discovered disk: %s -> %s", p.Mountpoint, name)
+				}
+			}
+			continue
+		}
+
+		// DYNAMIC NETWORK INTERFACES
+		if config.Type == "net_auto" || (config.Type == "net_rate" && config.PerInterface) {
+			cts, err := net.IOCounters(true)
+			if err != nil {
+				logErrorf("detecting network interfaces: %v", err)
+				continue
+			}
+			for _, ct := range cts {
+				// Without a pattern every interface but loopback is watched.
+				if ok, _ := filepath.Match(config.Interface, ct.Name); config.Interface != "" && !ok {
+					continue
+				}
+				if config.Interface == "" && ct.Name == "lo" {
+					continue
 				}
+				name := fmt.Sprintf("%s_%s", key, ct.Name)
+				c := config
+				c.Interface = ct.Name
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logDebugf("Discovered interface: %s -> %s", ct.Name, name)
+			}
+			continue
+		}
+
+		// PER BLOCK DEVICE
+		if config.Type == "disk_io" && config.PerDevice {
+			devices, err := diskIODevices(config.Device)
+			if err != nil {
+				logErrorf("detecting block devices: %v", err)
+				continue
+			}
+			for _, dev := range devices {
+				name := fmt.Sprintf("%s_%s", key, dev)
+				c := config
+				c.Device = dev
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logDebugf("Discovered block device: %s -> %s", dev, name)
+			}
+			continue
+		}
+
+		// PER GPU
+		if config.Type == "gpu" && config.PerDevice {
+			gpus, err := queryGPUs(context.Background())
+			if err != nil {
+				logErrorf("detecting GPUs: %v", err)
+				continue
+			}
+			for _, g := range gpus {
+				name := fmt.Sprintf("%s_%s", key, g.Index)
+				c := config
+				c.Device = g.Index
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logDebugf("Discovered GPU: %s (%s) -> %s", g.Index, g.Name, name)
+			}
+			continue
+		}
+
+		// PER SMART DEVICE
+		if config.Type == "smart" && config.PerDevice {
+			devices, err := smartDevices(context.Background())
+			if err != nil {
+				logErrorf("detecting SMART devices: %v", err)
+				continue
+			}
+			for _, dev := range devices {
+				name := fmt.Sprintf("%s_%s", key, smartDeviceKey(dev))
+				c := config
+				c.Device = dev
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logDebugf("Discovered SMART device: %s -> %s", dev, name)
+			}
+			continue
+		}
+
+		// PER ZFS POOL
+		if config.Type == "zfs" && config.PerDevice {
+			pools, err := listZpools(context.Background())
+			if err != nil {
+				logErrorf("detecting ZFS pools: %v", err)
+				continue
+			}
+			for _, p := range pools {
+				name := fmt.Sprintf("%s_%s", key, sanitizeName(p.Name))
+				c := config
+				c.Pool = p.Name
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logDebugf("Discovered ZFS pool: %s -> %s", p.Name, name)
+			}
+			continue
+		}
+
+		// DYNAMIC CONTAINERS
+		if config.Type == "container_auto" {
+			found, _ := discoverContainers(key, config)
+			for name, c := range found {
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logDebugf("Discovered container: %s -> %s", shortID(c.Container), name)
 			}
 			continue
 		}
 
 		// CPU PER CORE
 		if config.Type == "cpu" && config.Measure == "per_core" {
-			count, _ := cpu.Counts(true)
-			for i := 0; i < count; i++ {
+			// Some restricted containers report 0 (or fail); fall back to
+			// the Go runtime's view rather than silently creating nothing.
+			count, err := cpu.Counts(true)
+			if err != nil || count <= 0 {
+				logWarnf("%s: could not determine core count (%d, %v), falling back to runtime.NumCPU() = %d", key, count, err, runtime.NumCPU())
+				count = runtime.NumCPU()
+			}
+			cores, err := selectCores(config.CoreInclude, config.CoreStep, count)
+			if err != nil {
+				logErrorf("%s: %v", key, err)
+				continue
+			}
+			for _, i := range cores {
 				name := fmt.Sprintf("cpu_core_%d", i)
-				states[name] = &MetricState{Name: name, Config: config, FirstRun: true}
+				states[name] = newMetricState(name, config)
+				states[name].Source = key
 			}
 			continue
 		}
 
 		// STANDARD METRICS
-		states[key] = &MetricState{
-			Name:     key,
-			Config:   config,
-			FirstRun: true,
-		}
+		states[key] = newMetricState(key, config)
 	}
 	return states
 }
 
+// statesMu guards adding/removing states after startup. Only the main
+// goroutine mutates the map, so it only needs to lock for writes; other
+// goroutines (HTTP) take the read lock.
+var statesMu sync.RWMutex
+
+// reconcileStates re-runs discovery for container_auto entries, adding
+// states for new containers and dropping those for containers that are gone.
+func reconcileStates(cfg *Config, states map[string]*MetricState) {
+	for _, key := range sortedKeys(cfg.Metrics) {
+		config := cfg.Metrics[key]
+		if config.Type != "container_auto" {
+			continue
+		}
+		if config.SuppressInitial == nil {
+			config.SuppressInitial = &cfg.Global.SuppressInitial
+		}
+		found, ok := discoverContainers(key, config)
+		if !ok {
+			continue
+		}
+
+		statesMu.Lock()
+		for name, c := range found {
+			if _, ok := states[name]; !ok {
+				states[name] = newMetricState(name, c)
+				states[name].Source = key
+				logInfof("Discovered container: %s -> %s", shortID(c.Container), name)
+			}
+		}
+		for name, s := range states {
+			if _, ok := found[name]; s.Source == key && !ok {
+				delete(states, name)
+				logInfof("Container gone: %s", name)
+			}
+		}
+		statesMu.Unlock()
+	}
+}
+
 // --- Collection Logic ---
 
-func collectAndProcess(states map[string]*MetricState) {
+func collectAndProcess(states map[string]*MetricState, timeout time.Duration) {
+	beginTick(time.Now())
 	for _, state := range states {
 		// Run checks in parallel
-		go func(s *MetricState) {
-			val, err := getValue(s)
-			// We only broadcast if there was NO error.
-			if err == nil {
-				s.CheckAndBroadcast(val)
-			}
-		}(state)
+		go collectOne(state, timeout)
+	}
+}
+
+// collectInOrder runs the startup pass. Metrics are collected in parallel,
+// as on a tick, and the results applied in name order so the initial
+// broadcasts come out in a stable order. Self metrics report on the other
+// collections and broadcasts, so they are collected once those are done.
+func collectInOrder(states map[string]*MetricState, timeout time.Duration) {
+	beginTick(time.Now())
+	var names, self []string
+	for _, name := range sortedKeys(states) {
+		if states[name].Config.Type == "self" {
+			self = append(self, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	type result struct {
+		val float64
+		err error
+	}
+	results := make([]result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		s := states[name]
+		s.collecting.Lock()
+		wg.Go(func() {
+			results[i].val, results[i].err = s.collect(timeout)
+		})
+	}
+	wg.Wait()
+	for i, name := range names {
+		states[name].apply(results[i].val, results[i].err, timeout)
+		states[name].collecting.Unlock()
 	}
+	for _, name := range self {
+		collectOne(states[name], timeout)
+	}
+}
+
+func collectOne(s *MetricState, timeout time.Duration) {
+	// Still busy with an earlier tick: skip this one rather than queue up.
+	if !s.collecting.TryLock() {
+		return
+	}
+	defer s.collecting.Unlock()
+	val, err := s.collect(timeout)
+	s.apply(val, err, timeout)
+}
+
+// collect reads the metric's value. A disabled state reports errNotReady,
+// leaving nothing to apply. Called with s.collecting held.
+func (s *MetricState) collect(timeout time.Duration) (float64, error) {
+	if s.Disabled {
+		return 0, errNotReady
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	val, err := getValue(ctx, s)
+	observeCollect(s.Config.Type, time.Since(start))
+	return val, err
 }
 
-func getValue(s *MetricState) (float64, error) {
+// apply records a collected value or error: severity, actions, broadcast
+// and alerts. Called with s.collecting held.
+func (s *MetricState) apply(val float64, err error, timeout time.Duration) {
+	if errors.Is(err, errNotReady) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publishStatus()
+
+	if errors.Is(err, errUnsupported) {
+		logWarnf("Disabling %s: %v", s.Name, err)
+		s.Disabled = true
+		s.LastError = err.Error()
+		s.LastErrorTime = s.now()
+		s.setFailing(err)
+		return
+	}
+	if err == nil {
+		val, err = s.Config.plausible(val)
+	}
+	// We only broadcast if there was NO error.
+	if err != nil {
+		s.recordError(err)
+		s.setFailing(err)
+		return
+	}
+	s.setFailing(nil)
+	if s.Config.Scale != 0 {
+		val *= s.Config.Scale
+	}
+	val += s.Config.Offset
+	if s.Config.Invert {
+		val = 1 - val
+	}
+	// Treat near-zero jitter (idle interfaces, tiny CPU deltas) as zero.
+	if math.Abs(val) < s.Config.Deadband {
+		val = 0
+	}
+	s.LastError = ""
+	metricCache.set(s.Name, val, s.now())
+	first := s.FirstRun
+	sev, prev := s.updateSeverity(val)
+	s.runActions(sev, prev, val, timeout)
+	if !s.CheckAndBroadcast(val) && sev != prev && !first && !s.heldQuiet(sev) {
+		s.alert(val)
+	}
+}
+
+// heldQuiet reports whether quiet hours hold back a change to sev: only
+// crit gets through a quiet window, for alerting outputs as for broadcasts.
+func (s *MetricState) heldQuiet(sev string) bool {
+	return s.schedule.quiet(s.now()) && sev != "crit"
+}
+
+// publishStatus hands the state's current status to metricCache.
+func (s *MetricState) publishStatus() {
+	metricCache.setStatus(s.Name, stateStatus{
+		Severity:      s.Severity,
+		LastValue:     s.LastValue,
+		LastBroadcast: s.LastBroadcast,
+		LastError:     s.LastError,
+		LastErrorTime: s.LastErrorTime,
+	})
+}
+
+// sortedKeys returns map keys in lexical order, for deterministic logging.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setFailing tracks success/error transitions and emits an explicit
+// "error" or "recovered" event when the state flips, so a collector that
+// stops working is visible downstream instead of just going quiet.
+func (s *MetricState) setFailing(err error) {
+	switch {
+	case err != nil && !s.Failing:
+		s.Failing = true
+		s.broadcastEvent("error", err.Error())
+	case err == nil && s.Failing:
+		s.Failing = false
+		s.broadcastEvent("recovered", "")
+	}
+}
+
+// recordError stores the failure on the state. It only logs when the error
+// changes so a permanently broken metric doesn't flood the log every tick.
+func (s *MetricState) recordError(err error) {
+	msg := err.Error()
+	if msg != s.LastError {
+		logErrorf("%s: %v", s.Name, err)
+	}
+	s.LastError = msg
+	s.LastErrorTime = s.now()
+}
+
+// getValue collects one reading. Native collectors use gopsutil's
+// *WithContext calls so ctx (bounded by collect_timeout) can cancel them.
+func getValue(ctx context.Context, s *MetricState) (float64, error) {
 	switch s.Config.Type {
 
 	case "disk", "disk_auto":
-		u, err := disk.Usage(s.Config.Path)
+		if len(s.Config.Paths) > 0 {
+			return diskPathsValue(ctx, s.Config.Paths, s.Config.Measure, s.Config.Aggregate)
+		}
+		path := s.Config.Path
+		if s.Config.Device != "" {
+			mp, err := deviceMountpoint(ctx, s.Config.Device)
+			if err != nil {
+				return 0, err
+			}
+			path = mp
+		}
+		return diskValue(ctx, path, s.Config.Measure)
+
+	case "service":
+		return serviceValue(ctx, s.Config.Service, s.Config.Measure)
+
+	case "systemd_failed":
+		return failedUnits(ctx, s.Config.Service)
+
+	case "journal_rate":
+		return s.journalRateValue(ctx)
+
+	case "smart":
+		return smartValue(ctx, s.Config.Device, s.Config.Measure)
+
+	case "zfs":
+		return zfsValue(ctx, s.Config.Pool, s.Config.Measure)
+
+	case "net_rate", "net_auto":
+		c, now, err := netCounters(ctx, s.Config.Interface)
 		if err != nil {
 			return 0, err
 		}
+
+		var currentRaw uint64
 		switch s.Config.Measure {
-		case "percent_free":
-			return 100.0 - u.UsedPercent, nil
-		case "used_gb":
-			return float64(u.Used) / 1024 / 1024 / 1024, nil
-		case "free_gb":
-			return float64(u.Free) / 1024 / 1024 / 1024, nil
-		case "used_mb":
-			return float64(u.Used) / 1024 / 1024, nil
-		case "free_mb":
-			return float64(u.Free) / 1024 / 1024, nil
+		case "tx_mbps", "tx":
+			currentRaw = c.BytesSent
+		case "errin":
+			currentRaw = c.Errin
+		case "errout":
+			currentRaw = c.Errout
+		case "dropin":
+			currentRaw = c.Dropin
+		case "dropout":
+			currentRaw = c.Dropout
 		default:
-			return u.UsedPercent, nil
+			currentRaw = c.BytesRecv
 		}
 
-	case "service":
-		cmd := exec.Command("systemctl", "is-active", "--quiet", s.Config.Service)
-		err := cmd.Run()
-		if err != nil {
-			return 0.0, nil
+		// Total mode: the lifetime counter itself, no baseline needed.
+		if s.Config.Mode == "total" {
+			return float64(currentRaw), nil
 		}
-		return 1.0, nil
 
-	case "net_rate":
-		cts, err := net.IOCounters(false)
-		if err != nil || len(cts) == 0 {
-			return 0, fmt.Errorf("no net")
+		// Error/drop counters are reported as the number of new events
+		// since the previous sample; lifetime totals aren't useful for alerting.
+		switch s.Config.Measure {
+		case "errin", "errout", "dropin", "dropout":
+			delta, _, err := s.counterDelta(currentRaw, now)
+			return delta, err
 		}
 
-		var currentRaw uint64
-		if s.Config.Measure == "tx_mbps" {
-			currentRaw = cts[0].BytesSent
-		} else {
-			currentRaw = cts[0].BytesRecv
-		}
+		// Out-of-range results are rejected centrally by plausible().
+		bytesPerSec, err := s.counterRate(currentRaw, now)
+		return bytesPerSec * 8 / (1024 * 1024), err
 
-		now := time.Now()
+	case "net_quota":
+		return s.quotaValue(ctx)
 
-		// Note on Restart: We CANNOT broadcast a rate on the very first instant
-		// because we need a delta (Current - Previous).
-		// This block initializes the baseline so the SECOND tick (e.g. 1s later) works.
-		if s.LastTime.IsZero() {
-			s.LastRawCounter = currentRaw
-			s.LastTime = now
-			return 0, fmt.Errorf("initializing net rate")
-		}
+	case "disk_io":
+		return s.diskIOValue(ctx)
 
-		deltaBytes := float64(currentRaw - s.LastRawCounter)
-		deltaTime := now.Sub(s.LastTime).Seconds()
+	case "process":
+		return s.processValue(ctx)
 
-		s.LastRawCounter = currentRaw
-		s.LastTime = now
+	case "gpu":
+		return gpuValue(ctx, s.Config.Device, s.Config.Measure, s.Config.Aggregate)
 
-		if deltaTime <= 0 {
-			return 0, fmt.Errorf("time skew")
-		}
+	case "net_conn":
+		return netConnValue(ctx, s.Config.Measure, s.Config.Port)
 
-		mbps := (deltaBytes * 8) / (1024 * 1024) / deltaTime
-		if mbps < 0 {
-			mbps = 0
-		}
-		return mbps, nil
+	case "cpu_freq":
+		return s.cpuFreqValue(ctx)
+
+	case "sys_rate":
+		return s.sysRateValue()
 
 	case "cpu":
 		if s.Config.Measure == "total" {
-			c, _ := cpu.Percent(0, false)
+			c, _ := cpu.PercentWithContext(ctx, 0, false)
 			if len(c) > 0 {
 				return c[0], nil
 			}
 		} else if s.Config.Measure == "per_core" {
-			c, _ := cpu.Percent(0, true)
+			c, err := cpu.PercentWithContext(ctx, 0, true)
+			if err != nil {
+				return 0, err
+			}
 			var idx int
 			fmt.Sscanf(s.Name, "cpu_core_%d", &idx)
-			if idx < len(c) {
-				return c[idx], nil
+			if idx >= len(c) {
+				// Core went offline (hotplug) or is hidden from us now.
+				return 0, fmt.Errorf("core %d not reported (%d cores online)", idx, len(c))
+			}
+			return c[idx], nil
+		} else if s.Config.Measure == "max_core" || s.Config.Measure == "core_spread" {
+			// Busiest core, or busiest minus idlest: spots a single-threaded
+			// bottleneck that the total average hides.
+			c, _ := cpu.PercentWithContext(ctx, 0, true)
+			if len(c) > 0 {
+				maxV, minV := c[0], c[0]
+				for _, v := range c[1:] {
+					maxV = math.Max(maxV, v)
+					minV = math.Min(minV, v)
+				}
+				if s.Config.Measure == "max_core" {
+					return maxV, nil
+				}
+				return maxV - minV, nil
 			}
 		}
-		return 0, fmt.Errorf("cpu err")
+		if s.Config.Measure == "iowait_percent" || s.Config.Measure == "steal_percent" {
+			return s.cpuTimesPercent(ctx)
+		}
+		return 0, fmt.Errorf("cpu measure %q unavailable", s.Config.Measure)
 
 	case "mem":
-		v, _ := mem.VirtualMemory()
-		if s.Config.Measure == "free_gb" {
-			return float64(v.Free) / 1024 / 1024 / 1024, nil
+		v, err := mem.VirtualMemoryWithContext(ctx)
+		if err != nil {
+			return 0, err
+		}
+		const gb = 1024 * 1024 * 1024
+		// A percentage of nothing would be NaN; seen with a broken lxcfs
+		// meminfo.
+		noTotal := errors.New("MemTotal is 0")
+		switch s.Config.Measure {
+		case "free_gb":
+			return float64(v.Free) / gb, nil
+		case "available_gb":
+			// What can be allocated without swapping: free plus
+			// reclaimable cache. "free" alone is near 0 on a healthy host.
+			return float64(v.Available) / gb, nil
+		case "available_percent":
+			if v.Total == 0 {
+				return 0, noTotal
+			}
+			return float64(v.Available) / float64(v.Total) * 100, nil
+		case "used_gb":
+			return float64(v.Used) / gb, nil
+		case "cached_gb":
+			return float64(v.Cached) / gb, nil
+		case "buffers_gb":
+			return float64(v.Buffers) / gb, nil
+		}
+		if v.Total == 0 {
+			return 0, noTotal
 		}
 		return v.UsedPercent, nil
 
 	case "swap":
-		v, _ := mem.SwapMemory()
+		switch s.Config.Measure {
+		case "in_pages_s", "out_pages_s", "in_mb_s", "out_mb_s":
+			return s.swapRateValue()
+		}
+		v, err := mem.SwapMemoryWithContext(ctx)
+		if err != nil {
+			return 0, err
+		}
 		if s.Config.Measure == "free_gb" {
 			return float64(v.Free) / 1024 / 1024 / 1024, nil
 		}
 		return v.UsedPercent, nil
 
 	case "load":
-		l, _ := load.Avg()
-		return l.Load5, nil
+		return loadValue(ctx, s.Config.Measure, s.Config.Normalized)
+
+	case "self":
+		return selfValue(s.Config.Measure)
+
+	case "entropy":
+		return entropyValue()
+
+	case "fd":
+		if s.Config.Process != "" || s.Config.Pattern != "" || s.Config.PidFile != "" {
+			return processFDValue(ctx, s.Config)
+		}
+		return fdValue(s.Config.Measure)
+
+	case "container", "container_auto":
+		return s.containerValue(ctx)
+
+	case "psi":
+		return psiValue(s.Config.Resource, s.Config.Measure)
+
+	case "conntrack":
+		return conntrackValue(s.Config.Measure)
+
+	case "battery":
+		return batteryValue(s.Config.Battery, s.Config.Measure)
+
+	case "temp":
+		return tempValue(ctx, s.Config.Sensor, s.Config.Aggregate)
+
+	case "procs":
+		return procsValue(s.Config.Measure)
+
+	case "tcp_check":
+		return tcpCheck(ctx, s.Config.Host, s.Config.Port, s.Config.Measure)
 
 	case "uptime":
-		u, _ := host.Uptime()
+		// boot_time jumps on every reboot, which makes reboots easy to alert on.
+		if s.Config.Measure == "boot_time" {
+			b, err := host.BootTimeWithContext(ctx)
+			if err != nil {
+				return 0, err
+			}
+			return float64(b), nil
+		}
+		u, err := host.UptimeWithContext(ctx)
+		if err != nil {
+			return 0, err
+		}
+		switch s.Config.Measure {
+		case "seconds":
+			return float64(u), nil
+		case "minutes":
+			return float64(u) / 60, nil
+		case "days":
+			return float64(u) / 86400, nil
+		}
 		return float64(u) / 3600, nil
 	}
 
-	return 0, fmt.Errorf("unknown type")
+	return 0, fmt.Errorf("unknown type %q", s.Config.Type)
+}
+
+// selectCores resolves core_include ("0-3,8") and core_step against the
+// detected core count. Indices beyond the count are reported, not ignored.
+func selectCores(include string, step, count int) ([]int, error) {
+	var cores []int
+	if strings.TrimSpace(include) == "" {
+		for i := 0; i < count; i++ {
+			cores = append(cores, i)
+		}
+	} else {
+		seen := map[int]bool{}
+		for _, part := range strings.Split(include, ",") {
+			part = strings.TrimSpace(part)
+			lo, hi, isRange := strings.Cut(part, "-")
+			from, err := strconv.Atoi(strings.TrimSpace(lo))
+			if err != nil {
+				return nil, fmt.Errorf("core_include: bad entry %q", part)
+			}
+			to := from
+			if isRange {
+				if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || to < from {
+					return nil, fmt.Errorf("core_include: bad range %q", part)
+				}
+			}
+			if to >= count {
+				return nil, fmt.Errorf("core_include: %q exceeds detected cores (0-%d)", part, count-1)
+			}
+			for i := from; i <= to; i++ {
+				if !seen[i] {
+					seen[i] = true
+					cores = append(cores, i)
+				}
+			}
+		}
+		sort.Ints(cores)
+	}
+
+	if step > 1 {
+		var stepped []int
+		for i := 0; i < len(cores); i += step {
+			stepped = append(stepped, cores[i])
+		}
+		cores = stepped
+	}
+	return cores, nil
+}
+
+// cpuTimesPercent returns the share of CPU time spent in iowait or steal
+// since the previous sample. cpu.Percent can't provide these, so it works
+// from raw cpu.Times snapshots kept on the state.
+func (s *MetricState) cpuTimesPercent(ctx context.Context) (float64, error) {
+	ts, err := cpu.TimesWithContext(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(ts) == 0 {
+		return 0, fmt.Errorf("no cpu times")
+	}
+	cur := ts[0]
+	prev := s.LastCPUTimes
+	s.LastCPUTimes = &cur
+	if prev == nil {
+		return 0, errNotReady
+	}
+
+	// Guest time is already accounted in User on Linux, so it's left out.
+	total := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	}
+	deltaTotal := total(cur) - total(*prev)
+	if deltaTotal <= 0 {
+		return 0, errNotReady
+	}
+
+	part := cur.Iowait - prev.Iowait
+	if s.Config.Measure == "steal_percent" {
+		part = cur.Steal - prev.Steal
+	}
+	return math.Max(0, part/deltaTotal*100), nil
 }
 
-func broadcast(name string, value float64) {
-	log.Printf("[BROADCAST] %s: %.2f\n", name, value)
+// decodeJSONConfig decodes JSON keeping integers as integers, so large
+// values (ports, sizes) don't turn into floats like 1e+06 on the way
+// through YAML.
+func decodeJSONConfig(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var convert func(any) any
+	convert = func(v any) any {
+		switch t := v.(type) {
+		case json.Number:
+			if i, err := t.Int64(); err == nil {
+				return i
+			}
+			f, _ := t.Float64()
+			return f
+		case map[string]any:
+			for k, e := range t {
+				t[k] = convert(e)
+			}
+		case []any:
+			for i, e := range t {
+				t[i] = convert(e)
+			}
+		}
+		return v
+	}
+	return convert(v), nil
+}
+
+// netCounters returns the counters for one interface, the sum of those
+// matching a glob such as "wg*", or the sum of all interfaces when iface is
+// empty, from the current tick's shared snapshot. The returned time is the
+// tick's, so every rate in a tick uses the same timestamp.
+func netCounters(ctx context.Context, iface string) (net.IOCountersStat, time.Time, error) {
+	t := currentTick()
+	cts, err := t.netCounters(ctx)
+	if err != nil {
+		return net.IOCountersStat{}, t.at, err
+	}
+	if iface == "" || strings.ContainsAny(iface, "*?[") {
+		sum := net.IOCountersStat{Name: "all"}
+		n := 0
+		for _, c := range cts {
+			if ok, _ := filepath.Match(iface, c.Name); iface != "" && !ok {
+				continue
+			}
+			n++
+			sum.BytesSent += c.BytesSent
+			sum.BytesRecv += c.BytesRecv
+			sum.PacketsSent += c.PacketsSent
+			sum.PacketsRecv += c.PacketsRecv
+			sum.Errin += c.Errin
+			sum.Errout += c.Errout
+			sum.Dropin += c.Dropin
+			sum.Dropout += c.Dropout
+			sum.Fifoin += c.Fifoin
+			sum.Fifoout += c.Fifoout
+		}
+		if n == 0 {
+			if iface != "" {
+				return net.IOCountersStat{}, t.at, fmt.Errorf("no interface matches %q", iface)
+			}
+			return net.IOCountersStat{}, t.at, fmt.Errorf("no network counters")
+		}
+		return sum, t.at, nil
+	}
+	for _, c := range cts {
+		if c.Name == iface {
+			return c, t.at, nil
+		}
+	}
+	return net.IOCountersStat{}, t.at, fmt.Errorf("interface %q not found", iface)
 }
 
+// loadConfig reads the config from a file, from stdin when path is "-", or
+// assembles it from SM_* environment variables when path is empty. Files
+// ending in .json or .toml are decoded as such; anything else is YAML.
 func loadConfig(path string) (*Config, error) {
-	f, err := os.ReadFile(path)
+	var f []byte
+	var err error
+	switch path {
+	case "":
+		f, err = configFromEnv(os.Environ())
+	case "-":
+		f, err = io.ReadAll(os.Stdin)
+	default:
+		f, err = os.ReadFile(path)
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	// JSON and TOML are decoded generically and re-encoded as YAML, so all
+	// formats share the YAML struct tags and duration parsing ("30s").
+	var generic any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		generic, err = decodeJSONConfig(f)
+	case ".toml":
+		generic, err = parseTOML(string(f))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if generic != nil {
+		if f, err = yaml.Marshal(generic); err != nil {
+			return nil, err
+		}
+	}
+
 	var cfg Config
 	cfg.Global.CheckFrequency = 1 * time.Second
+	cfg.Global.CollectTimeout = 5 * time.Second
 	if err := yaml.Unmarshal(f, &cfg); err != nil {
 		return nil, err
 	}
+	for key, m := range cfg.Metrics {
+		if t, ok := typeAliases[m.Type]; ok {
+			m.Type = t
+			cfg.Metrics[key] = m
+		}
+	}
 	return &cfg, nil
 }
+
+// typeAliases maps alternative metric type names to the ones used in code.
+var typeAliases = map[string]string{
+	"docker":      "container",
+	"docker_auto": "container_auto",
+}
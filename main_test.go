@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// recordSink keeps every sample it is sent.
+type recordSink struct {
+	got []Sample
+}
+
+func (r *recordSink) Name() string { return "record" }
+
+func (r *recordSink) Send(s Sample) error {
+	r.got = append(r.got, s)
+	return nil
+}
+
+// testStart is a Monday noon, inside the quiet window used below.
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestState builds a state on a fake clock that broadcasts to the
+// returned sink only.
+func newTestState(t *testing.T, c MetricConfig) (*MetricState, *fakeClock, *recordSink) {
+	t.Helper()
+	rec := &recordSink{}
+	old := sinks
+	sinks = []Sink{rec}
+	t.Cleanup(func() { sinks = old })
+
+	s := newMetricState("m", c)
+	clock := newFakeClock(testStart)
+	s.clock = clock
+	return s, clock, rec
+}
+
+func TestCheckAndBroadcast(t *testing.T) {
+	suppress := true
+	quiet := ScheduleConfig{Timezone: "UTC", Quiet: []QuietWindow{{From: "11:00", To: "13:00"}}}
+
+	type step struct {
+		after time.Duration // Clock advance before the sample
+		value float64
+		sev   string // Severity of the sample; empty means ok
+		want  bool   // Broadcast expected
+	}
+	tests := []struct {
+		name  string
+		cfg   MetricConfig
+		steps []step
+	}{
+		{"first run", MetricConfig{Diff: 1, ResendInterval: time.Hour}, []step{
+			{0, 5, "", true},
+			{time.Second, 5, "", false},
+		}},
+		{"first run suppressed", MetricConfig{Diff: 1, ResendInterval: time.Hour, SuppressInitial: &suppress}, []step{
+			{0, 5, "", false},
+			{time.Second, 5.5, "", false},
+			{time.Second, 6, "", true}, // Diff from the suppressed baseline
+		}},
+		{"heartbeat", MetricConfig{Diff: 10, ResendInterval: time.Hour}, []step{
+			{0, 5, "", true},
+			{59 * time.Minute, 6, "", false},
+			{time.Minute, 6, "", true},
+			{time.Minute, 6, "", false},
+		}},
+		{"diff", MetricConfig{Diff: 10, ResendInterval: time.Hour}, []step{
+			{0, 50, "", true},
+			{time.Second, 59, "", false},
+			{time.Second, 60, "", true},
+			{time.Second, 51, "", false}, // Measured from the last broadcast
+			{time.Second, 50, "", true},
+		}},
+		{"diff direction up", MetricConfig{Diff: 10, DiffDirection: "up", ResendInterval: time.Hour}, []step{
+			{0, 50, "", true},
+			{time.Second, 20, "", false},
+			{time.Second, 60, "", true},
+		}},
+		{"diff_percent", MetricConfig{DiffPercent: 10, ResendInterval: time.Hour}, []step{
+			{0, 200, "", true},
+			{time.Second, 215, "", false},
+			{time.Second, 180, "", true},
+		}},
+		{"interval", MetricConfig{Diff: 1, Interval: time.Minute, ResendInterval: time.Hour}, []step{
+			{0, 0, "", true},
+			{30 * time.Second, 10, "", false},
+			{30 * time.Second, 10, "", true},
+		}},
+		{"max_broadcast_rate", MetricConfig{Diff: 1, MaxBroadcastRate: 10 * time.Minute, ResendInterval: time.Hour}, []step{
+			{0, 0, "", true},
+			{time.Minute, 50, "", false},
+			{8 * time.Minute, 90, "", false},
+			{time.Minute, 90, "", true},
+		}},
+		{"max_broadcast_rate keeps heartbeat", MetricConfig{Diff: 1, MaxBroadcastRate: 2 * time.Hour, ResendInterval: time.Hour}, []step{
+			{0, 0, "", true},
+			{time.Hour, 0, "", true},
+		}},
+		{"max_resend_interval", MetricConfig{Diff: 1, ResendInterval: time.Minute, MaxResendInterval: 4 * time.Minute}, []step{
+			{0, 5, "", true},
+			{time.Minute, 5, "", true},
+			{time.Minute, 5, "", false},
+			{time.Minute, 5, "", true},
+			{2 * time.Minute, 5, "", false},
+			{2 * time.Minute, 5, "", true},
+		}},
+		{"quiet hours hold warn", MetricConfig{Diff: 1, ResendInterval: 3 * time.Hour, Schedule: quiet}, []step{
+			{0, 0, "", true},
+			{time.Minute, 50, "warn", false},
+			{2 * time.Hour, 50, "warn", true}, // Window over
+		}},
+		{"quiet hours pass crit", MetricConfig{Diff: 1, ResendInterval: 3 * time.Hour, Schedule: quiet}, []step{
+			{0, 0, "", true},
+			{time.Minute, 90, "crit", true},
+		}},
+		{"quiet hours keep heartbeat", MetricConfig{Diff: 1, ResendInterval: 30 * time.Minute, Schedule: quiet}, []step{
+			{0, 0, "", true},
+			{30 * time.Minute, 0, "", true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, clock, rec := newTestState(t, tt.cfg)
+			for i, st := range tt.steps {
+				clock.Advance(st.after)
+				s.Severity = "ok"
+				if st.sev != "" {
+					s.Severity = st.sev
+				}
+				before := len(rec.got)
+				sent := s.CheckAndBroadcast(st.value)
+				if got := len(rec.got) > before; got != st.want || sent != st.want {
+					t.Fatalf("step %d (value %g): broadcast %v, reported %v, want %v", i, st.value, got, sent, st.want)
+				}
+				if st.want && rec.got[len(rec.got)-1].Value != st.value {
+					t.Fatalf("step %d: broadcast value %g, want %g", i, rec.got[len(rec.got)-1].Value, st.value)
+				}
+			}
+		})
+	}
+}
+
+// alertRecordSink is a recordSink that counts as an alerting output.
+type alertRecordSink struct{ *recordSink }
+
+func (alertRecordSink) alerting() {}
+
+// TestApplyAlerts checks which severity changes reach an alerting output
+// when no broadcast goes out.
+func TestApplyAlerts(t *testing.T) {
+	warn, crit := 40.0, 90.0
+	suppress := true
+	quiet := ScheduleConfig{Timezone: "UTC", Quiet: []QuietWindow{{From: "11:00", To: "13:00"}}}
+
+	type step struct {
+		after time.Duration
+		value float64
+		want  int // Samples received so far
+	}
+	tests := []struct {
+		name  string
+		cfg   MetricConfig
+		steps []step
+	}{
+		{"change held by diff", MetricConfig{Diff: 100, ResendInterval: 24 * time.Hour}, []step{
+			{0, 0, 1},
+			{time.Minute, 50, 2}, // Warn: alerted without a broadcast
+			{time.Minute, 55, 2},
+		}},
+		{"warn inside quiet window", MetricConfig{Diff: 100, ResendInterval: 24 * time.Hour, Schedule: quiet}, []step{
+			{0, 0, 1},
+			{time.Minute, 50, 1}, // Held like the broadcast
+			{time.Minute, 95, 2}, // Crit gets through
+		}},
+		{"suppressed first run", MetricConfig{Diff: 100, ResendInterval: 24 * time.Hour, SuppressInitial: &suppress}, []step{
+			{0, 50, 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Warn, tt.cfg.Crit = &warn, &crit
+			s, clock, rec := newTestState(t, tt.cfg)
+			sinks = []Sink{alertRecordSink{rec}}
+			for i, st := range tt.steps {
+				clock.Advance(st.after)
+				s.apply(st.value, nil, time.Second)
+				if len(rec.got) != st.want {
+					t.Fatalf("step %d (value %g): %d samples sent, want %d", i, st.value, len(rec.got), st.want)
+				}
+			}
+		})
+	}
+}
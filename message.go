@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// --- Severity, Units & Messages ---
+
+// severity classifies a value against the warn/crit thresholds and returns
+// the threshold that applies (the warn level while still ok).
+func (c MetricConfig) severity(v float64) (string, float64) {
+	breached := func(t float64) bool {
+		if c.ThresholdBelow {
+			return v <= t
+		}
+		return v >= t
+	}
+
+	if c.Crit != nil && breached(*c.Crit) {
+		return "crit", *c.Crit
+	}
+	if c.Warn != nil && breached(*c.Warn) {
+		return "warn", *c.Warn
+	}
+	if c.Warn != nil {
+		return "ok", *c.Warn
+	}
+	if c.Crit != nil {
+		return "ok", *c.Crit
+	}
+	return "ok", 0
+}
+
+// thresholdFor is the threshold reported alongside sev, matching severity().
+func (c MetricConfig) thresholdFor(sev string) float64 {
+	switch {
+	case sev == "crit" && c.Crit != nil:
+		return *c.Crit
+	case c.Warn != nil:
+		return *c.Warn
+	case c.Crit != nil:
+		return *c.Crit
+	}
+	return 0
+}
+
+// updateSeverity sets s.Severity from the new value and returns the previous
+// one. With `for` set, a level only takes effect once its threshold has been
+// breached continuously for that long; until then the lower level holds.
+// A level still in effect after escalate_after emits one "escalated" event.
+func (s *MetricState) updateSeverity(value float64) (sev, prev string) {
+	now := s.now()
+	raw, _ := s.Config.severity(value)
+
+	held := func(since *time.Time, breached bool) bool {
+		if !breached {
+			*since = time.Time{}
+			return false
+		}
+		if since.IsZero() {
+			*since = now
+		}
+		return now.Sub(*since) >= s.Config.For
+	}
+	critHeld := held(&s.critSince, raw == "crit")
+	warnHeld := held(&s.warnSince, raw == "warn" || (raw == "crit" && s.Config.Warn != nil))
+
+	sev = "ok"
+	since := time.Time{}
+	switch {
+	case critHeld:
+		sev, since = "crit", s.critSince
+	case warnHeld:
+		sev, since = "warn", s.warnSince
+	}
+	prev, s.Severity = s.Severity, sev
+
+	if sev == "ok" || sev != prev {
+		s.escalated = false
+	}
+	if s.Config.EscalateAfter > 0 && sev != "ok" && !s.escalated && now.Sub(since) >= s.Config.EscalateAfter {
+		s.escalated = true
+		s.broadcastEvent("escalated", fmt.Sprintf("%s for %s", sev, now.Sub(since).Round(time.Second)))
+	}
+	return sev, prev
+}
+
+// unit returns the configured unit, or one derived from the measure name.
+func (c MetricConfig) unit() string {
+	if c.Unit != "" {
+		return c.Unit
+	}
+	return c.nativeUnit()
+}
+
+// nativeUnit is the unit of the raw collected value.
+func (c MetricConfig) nativeUnit() string {
+	m := c.Measure
+	if c.Mode == "total" && (c.Type == "net_rate" || c.Type == "net_auto") {
+		switch m {
+		case "rx_mbps", "tx_mbps", "rx", "tx", "":
+			return "bytes"
+		}
+		return ""
+	}
+	if c.Mode == "total" && (c.Type == "container" || c.Type == "container_auto") && (m == "cpu_percent" || m == "") {
+		return "s"
+	}
+	if c.Mode == "total" && c.Type == "swap" {
+		switch m {
+		case "in_pages_s", "out_pages_s":
+			return "pages"
+		case "in_mb_s", "out_mb_s":
+			return "MB"
+		}
+	}
+	if c.Mode == "total" && c.Type == "disk_io" {
+		switch m {
+		case "read_mb_s", "write_mb_s", "":
+			return "bytes"
+		case "util_percent":
+			return "ms"
+		}
+		return ""
+	}
+	switch {
+	case m == "inodes_free":
+		return ""
+	case c.Type == "uptime":
+		switch m {
+		case "seconds":
+			return "s"
+		case "minutes":
+			return "min"
+		case "days":
+			return "d"
+		case "boot_time":
+			return "epoch"
+		}
+		return "h"
+	case strings.HasPrefix(m, "percent") || strings.HasSuffix(m, "_percent") || m == "per_core" || m == "max_core" || m == "core_spread":
+		return "%"
+	case strings.HasSuffix(m, "_gb"):
+		return "GB"
+	case strings.HasSuffix(m, "_mb"):
+		return "MB"
+	case strings.HasSuffix(m, "_mbps"):
+		return "Mbps"
+	case strings.HasSuffix(m, "_ms"):
+		return "ms"
+	case strings.HasSuffix(m, "_mb_s"):
+		return "MB/s"
+	case strings.HasSuffix(m, "iops"):
+		return "IOPS"
+	case strings.HasSuffix(m, "_w"):
+		return "W"
+	case strings.HasSuffix(m, "_mhz"):
+		return "MHz"
+	case strings.HasSuffix(m, "_pages_s"):
+		return "pages/s"
+	}
+	switch c.Type {
+	case "temp":
+		return "°C"
+	case "cpu_freq":
+		return "MHz" // avg_mhz, the default
+	case "sys_rate":
+		if c.Mode == "total" {
+			return ""
+		}
+		return "/s"
+	case "smart":
+		switch m {
+		case "temperature":
+			return "°C"
+		case "percentage_used":
+			return "%"
+		}
+	case "gpu":
+		if m == "temperature" {
+			return "°C"
+		}
+		return "%" // util_percent, the default
+	case "disk_io":
+		return "MB/s"
+	case "disk", "disk_auto", "mem", "swap", "cpu", "psi":
+		return "%" // default measures are percentages
+	}
+	return ""
+}
+
+// plausibleMaxMbps caps network rates; anything above 1 Tbit/s on a host
+// interface is a counter glitch, not traffic.
+const plausibleMaxMbps = 1_000_000
+
+// plausible rejects physically impossible raw readings (negative sizes,
+// percentages above 100, absurd rates) so they surface as collection
+// errors instead of false alerts. Readings within the tolerance of a
+// bound are clamped to it to absorb float noise.
+func (c MetricConfig) plausible(v float64) (float64, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("implausible value %v", v)
+	}
+
+	tol := c.Tolerance
+	if tol == 0 {
+		tol = 0.5
+	}
+	lo, hi := 0.0, math.Inf(1)
+	switch c.nativeUnit() {
+	case "%":
+		// Container and process CPU is relative to one core and can exceed
+		// 100, as can quota usage once the limit is blown and NVMe wear
+		// past the rated endurance.
+		if c.Measure != "cpu_percent" && c.Type != "net_quota" && c.Measure != "percentage_used" {
+			hi = 100
+		}
+	case "Mbps":
+		hi = plausibleMaxMbps
+	case "°C":
+		// Below this is a sensor glitch, as is the 255 some chips report.
+		lo, hi = -60, 150
+	}
+
+	switch {
+	case v < lo-tol || v > hi+tol:
+		return 0, fmt.Errorf("implausible value %.4g %s (expected %g..%g)", v, c.nativeUnit(), lo, hi)
+	case v < lo:
+		return lo, nil
+	case v > hi:
+		return hi, nil
+	}
+	return v, nil
+}
+
+// boolean reports whether the metric is a 0/1 state (service up, port
+// reachable, battery charging, container running) rather than a quantity.
+func (c MetricConfig) boolean() bool {
+	switch c.Type {
+	case "service":
+		return c.Measure == "" || c.Measure == "active" || c.Measure == "failed"
+	case "tcp_check":
+		return c.Measure == "" || c.Measure == "reachable"
+	case "battery":
+		return c.Measure == "charging" || c.Measure == "on_ac"
+	case "container", "container_auto":
+		return c.Measure == "running"
+	case "cpu_freq":
+		return c.Measure == "throttled"
+	case "smart", "zfs":
+		return c.Measure == "" || c.Measure == "healthy"
+	}
+	return false
+}
+
+// boolLabel renders a 0/1 value with bool_format ("up/down", "true/false",
+// or any "<label for 1>/<label for 0>"). It returns "" when the metric isn't
+// boolean or has no format, so callers fall back to the number.
+func (c MetricConfig) boolLabel(v float64) string {
+	if c.BoolFormat == "" || !c.boolean() {
+		return ""
+	}
+	on, off, ok := strings.Cut(c.BoolFormat, "/")
+	if !ok {
+		return ""
+	}
+	if v >= 0.5 {
+		return on
+	}
+	return off
+}
+
+// messageData is what a message_template can reference.
+type messageData struct {
+	Name      string
+	Value     float64
+	Label     string
+	Unit      string
+	Severity  string
+	Threshold float64
+}
+
+func (s *MetricState) renderMessage(sample Sample) string {
+	var b strings.Builder
+	err := s.tmpl.Execute(&b, messageData{
+		Name:      sample.Name,
+		Value:     sample.Value,
+		Label:     sample.Label,
+		Unit:      sample.Unit,
+		Severity:  sample.Severity,
+		Threshold: sample.Threshold,
+	})
+	if err != nil {
+		logErrorf("%s: message_template: %v", s.Name, err)
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// --- Stream/Datagram Connections for Line Sinks ---
+
+const netSinkTimeout = 10 * time.Second
+
+// maxDatagram keeps a datagram within one Ethernet frame (1500 MTU less IP,
+// UDP and some headroom for tunnels), so it isn't fragmented or dropped.
+const maxDatagram = 1432
+
+// netConn is a lazily dialed TCP, UDP or unix socket connection shared by
+// the simple line-oriented sinks. Any write error drops the connection so the next
+// send (from the retry queue) reconnects.
+type netConn struct {
+	network, addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newNetConn(network, addr string) (*netConn, error) {
+	switch network {
+	case "":
+		network = "tcp"
+	case "tcp", "udp":
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, err
+		}
+	case "unix", "unixgram": // addr is a socket path
+		if addr == "" {
+			return nil, fmt.Errorf("missing socket path")
+		}
+	default:
+		return nil, fmt.Errorf("protocol must be tcp, udp, unix or unixgram, got %q", network)
+	}
+	return &netConn{network: network, addr: addr}, nil
+}
+
+// write sends b as a single write (one datagram for UDP).
+func (c *netConn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		conn, err := net.DialTimeout(c.network, c.addr, netSinkTimeout)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(netSinkTimeout))
+	if _, err := c.conn.Write(b); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+// writeLines writes newline-terminated lines. Streams get them in one write;
+// datagram sockets get as many whole lines per packet as fit in maxDatagram,
+// so a long summary isn't truncated or dropped by the receiver. A single
+// line longer than that is sent alone.
+func (c *netConn) writeLines(b []byte) error {
+	if c.network != "udp" && c.network != "unixgram" {
+		return c.write(b)
+	}
+	for len(b) > 0 {
+		n := len(b)
+		if n > maxDatagram {
+			n = bytes.LastIndexByte(b[:maxDatagram], '\n') + 1
+			if n == 0 {
+				n = bytes.IndexByte(b, '\n') + 1
+				if n == 0 {
+					n = len(b)
+				}
+			}
+		}
+		if err := c.write(b[:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
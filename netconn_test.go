@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// udpListener returns a local UDP socket and a function reading the
+// datagrams sent to it so far.
+func udpListener(t *testing.T) (string, func() []string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc.LocalAddr().String(), func() []string {
+		var got []string
+		buf := make([]byte, 64<<10)
+		for {
+			pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return got
+			}
+			got = append(got, string(buf[:n]))
+		}
+	}
+}
+
+func TestNetConnWriteLinesSplitsDatagrams(t *testing.T) {
+	addr, read := udpListener(t)
+	c, err := newNetConn("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	for i := range 200 {
+		fmt.Fprintf(&b, "stat_monitor.host.summary.metric_%03d 12.5 1700000000\n", i)
+	}
+	if err := c.writeLines(b.Bytes()); err != nil {
+		t.Fatalf("writeLines: %v", err)
+	}
+
+	packets := read()
+	if len(packets) < 2 {
+		t.Fatalf("%d packets, want the lines split", len(packets))
+	}
+	for i, p := range packets {
+		if len(p) > maxDatagram {
+			t.Errorf("packet %d is %d bytes, over %d", i, len(p), maxDatagram)
+		}
+		if !strings.HasSuffix(p, "\n") {
+			t.Errorf("packet %d splits a line: ...%q", i, p[len(p)-10:])
+		}
+	}
+	if got := strings.Join(packets, ""); got != b.String() {
+		t.Fatal("lines lost or reordered across packets")
+	}
+}
+
+func TestNetConnWriteLinesLongLine(t *testing.T) {
+	addr, read := udpListener(t)
+	c, err := newNetConn("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 2000) + "\n"
+	if err := c.writeLines([]byte("a 1 2\n" + long + "b 1 2\n")); err != nil {
+		t.Fatalf("writeLines: %v", err)
+	}
+	want := []string{"a 1 2\n", long, "b 1 2\n"}
+	if got := read(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("packets %d, want the long line on its own", len(got))
+	}
+}
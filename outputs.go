@@ -0,0 +1,318 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- Outputs ---
+//
+// Broadcast destinations configured under `outputs:`. Each block has an
+// `enabled` flag (default true once the block is configured), and any
+// number can be active at once; every broadcast fans out to all of them.
+// Each one is a Sink named after its config key, so metrics can route to
+// it with `sinks:`. Network destinations sit behind the retry queue.
+
+type OutputsConfig struct {
+	Log        LogOutputConfig    `yaml:"log"`
+	File       FileOutputConfig   `yaml:"file"`
+	MQTT       MQTTConfig         `yaml:"mqtt"`
+	Webhook    WebhookConfig      `yaml:"webhook"`
+	Prometheus PrometheusConfig   `yaml:"prometheus"` // Pull-based: served, not a sink
+	InfluxDB   InfluxConfig       `yaml:"influxdb"`
+	Graphite   GraphiteConfig     `yaml:"graphite"`
+	StatsD     StatsDConfig       `yaml:"statsd"`
+	Socket     SocketOutputConfig `yaml:"socket"`
+	Syslog     SyslogConfig       `yaml:"syslog"`
+	Kafka      KafkaConfig        `yaml:"kafka"`
+	NATS       NATSConfig         `yaml:"nats"`
+	Redis      RedisConfig        `yaml:"redis"`
+	OTLP       OTLPConfig         `yaml:"otlp"`
+	CloudWatch CloudWatchConfig   `yaml:"cloudwatch"`
+	Zabbix     ZabbixConfig       `yaml:"zabbix"`
+	SNMPTrap   SNMPTrapConfig     `yaml:"snmp_trap"`
+	DBus       DBusConfig         `yaml:"dbus"`
+	Ntfy       PushConfig         `yaml:"ntfy"`
+	Gotify     PushConfig         `yaml:"gotify"`
+	Slack      ChatConfig         `yaml:"slack"`
+	Discord    ChatConfig         `yaml:"discord"`
+	Teams      ChatConfig         `yaml:"teams"`
+	Email      EmailConfig        `yaml:"email"`
+	PagerDuty  IncidentConfig     `yaml:"pagerduty"`
+	Opsgenie   IncidentConfig     `yaml:"opsgenie"`
+	Exec       ExecOutputConfig   `yaml:"exec"`
+	Nagios     NagiosConfig       `yaml:"nagios"`
+}
+
+// OutputToggle is inlined into every output block.
+type OutputToggle struct {
+	Enabled *bool `yaml:"enabled"` // Set false to keep a block configured but off
+}
+
+func (t OutputToggle) enabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+type LogOutputConfig struct {
+	OutputToggle `yaml:",inline"`
+}
+
+// outputTable is every sink that can be configured under `outputs:`, in
+// fan-out order. Adding a destination takes a config block, a Sink and an
+// entry here. build returns nil, nil when the block isn't configured.
+var outputTable = []struct {
+	key    string
+	remote bool // Deliver through the retry queue
+	build  func(o *OutputsConfig) (Sink, error)
+}{
+	{"log", false, func(o *OutputsConfig) (Sink, error) {
+		if !o.Log.enabled() {
+			return nil, nil
+		}
+		return logSink{}, nil
+	}},
+	{"file", false, func(o *OutputsConfig) (Sink, error) {
+		if !o.File.enabled() || o.File.Path == "" {
+			return nil, nil
+		}
+		return newFileSink(o.File)
+	}},
+	{"mqtt", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.MQTT.enabled() || o.MQTT.Broker == "" {
+			return nil, nil
+		}
+		return newMQTTSink(o.MQTT)
+	}},
+	{"webhook", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Webhook.enabled() || o.Webhook.URL == "" {
+			return nil, nil
+		}
+		return newWebhookSink(o.Webhook)
+	}},
+	{"influxdb", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.InfluxDB.enabled() || o.InfluxDB.URL == "" {
+			return nil, nil
+		}
+		return newInfluxSink(o.InfluxDB)
+	}},
+	{"graphite", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Graphite.enabled() || o.Graphite.Address == "" {
+			return nil, nil
+		}
+		return newGraphiteSink(o.Graphite)
+	}},
+	{"statsd", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.StatsD.enabled() || o.StatsD.Address == "" {
+			return nil, nil
+		}
+		return newStatsDSink(o.StatsD)
+	}},
+	{"socket", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Socket.enabled() || o.Socket.Address == "" {
+			return nil, nil
+		}
+		return newSocketSink(o.Socket)
+	}},
+	{"syslog", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Syslog.enabled() || o.Syslog.Address == "" {
+			return nil, nil
+		}
+		return newSyslogSink(o.Syslog)
+	}},
+	{"kafka", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Kafka.enabled() || len(o.Kafka.Brokers) == 0 {
+			return nil, nil
+		}
+		return newKafkaSink(o.Kafka)
+	}},
+	{"nats", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.NATS.enabled() || o.NATS.URL == "" {
+			return nil, nil
+		}
+		return newNATSSink(o.NATS)
+	}},
+	{"redis", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Redis.enabled() || o.Redis.Address == "" {
+			return nil, nil
+		}
+		return newRedisSink(o.Redis)
+	}},
+	{"otlp", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.OTLP.enabled() || o.OTLP.Endpoint == "" {
+			return nil, nil
+		}
+		return newOTLPSink(o.OTLP)
+	}},
+	{"cloudwatch", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.CloudWatch.enabled() || o.CloudWatch.Namespace == "" {
+			return nil, nil
+		}
+		return newCloudWatchSink(o.CloudWatch)
+	}},
+	{"zabbix", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Zabbix.enabled() || o.Zabbix.Server == "" {
+			return nil, nil
+		}
+		return newZabbixSink(o.Zabbix)
+	}},
+	{"snmp_trap", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.SNMPTrap.enabled() || o.SNMPTrap.Target == "" {
+			return nil, nil
+		}
+		return newSNMPTrapSink(o.SNMPTrap)
+	}},
+	{"dbus", true, func(o *OutputsConfig) (Sink, error) {
+		// Nothing is required, so the block needs bus: or enabled: true.
+		if !o.DBus.enabled() || (o.DBus.Enabled == nil && o.DBus.Bus == "") {
+			return nil, nil
+		}
+		return newDBusSink(o.DBus)
+	}},
+	{"ntfy", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Ntfy.enabled() || (o.Ntfy.Topic == "" && len(o.Ntfy.Metrics) == 0) {
+			return nil, nil
+		}
+		return newNtfySink(o.Ntfy)
+	}},
+	{"gotify", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Gotify.enabled() || o.Gotify.URL == "" {
+			return nil, nil
+		}
+		return newGotifySink(o.Gotify)
+	}},
+	{"slack", true, func(o *OutputsConfig) (Sink, error) {
+		return buildChat("slack", o.Slack)
+	}},
+	{"discord", true, func(o *OutputsConfig) (Sink, error) {
+		return buildChat("discord", o.Discord)
+	}},
+	{"teams", true, func(o *OutputsConfig) (Sink, error) {
+		return buildChat("teams", o.Teams)
+	}},
+	{"email", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Email.enabled() || o.Email.Server == "" {
+			return nil, nil
+		}
+		return newEmailSink(o.Email)
+	}},
+	{"pagerduty", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.PagerDuty.enabled() || o.PagerDuty.Key == "" {
+			return nil, nil
+		}
+		return newIncidentSink("pagerduty", o.PagerDuty)
+	}},
+	{"opsgenie", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Opsgenie.enabled() || o.Opsgenie.Key == "" {
+			return nil, nil
+		}
+		return newIncidentSink("opsgenie", o.Opsgenie)
+	}},
+	{"exec", false, func(o *OutputsConfig) (Sink, error) {
+		if !o.Exec.enabled() || o.Exec.Command == "" {
+			return nil, nil
+		}
+		return newExecSink(o.Exec)
+	}},
+	{"nagios", true, func(o *OutputsConfig) (Sink, error) {
+		if !o.Nagios.enabled() || (o.Nagios.NSCA == "" && o.Nagios.CommandFile == "" && o.Nagios.Livestatus == "") {
+			return nil, nil
+		}
+		return newNagiosSink(o.Nagios)
+	}},
+}
+
+func buildChat(name string, cfg ChatConfig) (Sink, error) {
+	if !cfg.enabled() || (cfg.URL == "" && len(cfg.Metrics) == 0) {
+		return nil, nil
+	}
+	return newChatSink(name, cfg)
+}
+
+// setupOutputs builds the enabled sinks. A destination with a broken config
+// is logged and skipped so the rest still start.
+func setupOutputs(cfg *Config) []Sink {
+	o := cfg.Outputs
+	// The older global settings still work when the outputs block is unset.
+	if cfg.Global.LogBroadcasts != nil && o.Log.Enabled == nil {
+		o.Log.Enabled = cfg.Global.LogBroadcasts
+	}
+	if o.File.Path == "" {
+		o.File = cfg.Global.OutputFile
+	}
+
+	var out []Sink
+	for _, def := range outputTable {
+		s, err := def.build(&o)
+		if err != nil {
+			logErrorf("outputs.%s: %v", def.key, err)
+			continue
+		}
+		if s == nil {
+			continue
+		}
+		if def.remote {
+			s = wrapRemote(s, cfg.Global.Retry)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// hostName is this machine's hostname, for topics, tags and payloads.
+var hostName = sync.OnceValue(func() string {
+	h, err := os.Hostname()
+	if err != nil || h == "" {
+		return "localhost"
+	}
+	return h
+})
+
+// expandName fills the {host} and {metric} placeholders of a topic/key pattern.
+func expandName(pattern, metric string) string {
+	return strings.NewReplacer("{host}", hostName(), "{metric}", metric).Replace(pattern)
+}
+
+// family is the name a metric is exported under by label-aware outputs:
+// auto-discovered states share their config key and are told apart by
+// labels (path, interface, core, container) rather than one name each.
+func (s *MetricState) family() string {
+	if s.Source != "" {
+		return s.Source
+	}
+	return s.Name
+}
+
+// labels identifies what a metric watches, for outputs with tags/labels.
+func (s *MetricState) labels() map[string]string {
+	c := s.Config
+	labels := map[string]string{}
+	add := func(k, v string) {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	add("path", c.Path)
+	add("device", c.Device)
+	add("interface", c.Interface)
+	add("service", c.Service)
+	add("resource", c.Resource)
+	add("sensor", c.Sensor)
+	add("process", c.Process)
+	add("pool", c.Pool)
+	if c.Type == "cpu" && c.Measure == "per_core" {
+		add("core", strings.TrimPrefix(s.Name, "cpu_core_"))
+	}
+	if c.Type == "container_auto" && s.Source != "" {
+		add("container", strings.TrimPrefix(s.Name, s.Source+"_"))
+	} else {
+		add("container", c.Container)
+	}
+	if c.Host != "" {
+		add("target", c.Host+":"+strconv.Itoa(c.Port))
+	} else if c.Type == "net_conn" && c.Port != 0 {
+		add("port", strconv.Itoa(c.Port))
+	}
+	return labels
+}
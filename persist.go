@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --- Persistent State ---
+//
+// Metrics that accumulate over long periods (net_quota) keep their state in
+// global.state_file so it survives restarts. Updates are written at most
+// once per persistInterval and once more on shutdown; a crash loses at most
+// that much accumulation.
+
+const persistInterval = time.Minute
+
+type stateStore struct {
+	mu       sync.Mutex
+	path     string // Empty disables persistence
+	m        map[string]json.RawMessage
+	dirty    bool
+	lastSave time.Time
+}
+
+var persisted = &stateStore{m: map[string]json.RawMessage{}}
+
+// load reads an existing state file. A missing file is a fresh start.
+func (st *stateStore) load(path string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.path = path
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &st.m)
+}
+
+// get decodes the saved entry for name into v and reports whether there was one.
+func (st *stateStore) get(name string, v any) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	raw, ok := st.m[name]
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		logWarnf("state file: discarding %s: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// put records v for name and saves if the last write is old enough.
+func (st *stateStore) put(name string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logErrorf("state file: %s: %v", name, err)
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.m[name] = b
+	st.dirty = true
+	if time.Since(st.lastSave) >= persistInterval {
+		st.saveLocked()
+	}
+}
+
+// flush writes pending changes, e.g. on shutdown.
+func (st *stateStore) flush() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.dirty {
+		st.saveLocked()
+	}
+}
+
+// saveLocked replaces the file atomically so a crash mid-write never
+// leaves a truncated state file behind.
+func (st *stateStore) saveLocked() {
+	st.lastSave = time.Now()
+	if st.path == "" {
+		return
+	}
+	b, err := json.MarshalIndent(st.m, "", "  ")
+	if err != nil {
+		logErrorf("state file: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(st.path), ".stat-monitor-state-*")
+	if err != nil {
+		logErrorf("state file: %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		logErrorf("state file: %v", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		logErrorf("state file: %v", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), st.path); err != nil {
+		logErrorf("state file: %v", err)
+		return
+	}
+	st.dirty = false
+}
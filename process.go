@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// processValue reads one measure summed over the processes selected by
+// process (name), pattern (regex over the command line) and/or pidfile.
+// count is the number of matches and is 0 when nothing runs; every other
+// measure fails then, so a stopped service surfaces as an error rather
+// than as zero memory.
+func (s *MetricState) processValue(ctx context.Context) (float64, error) {
+	procs, err := matchProcesses(ctx, s.Config)
+	if err != nil {
+		return 0, err
+	}
+	if s.Config.Measure == "count" {
+		return float64(len(procs)), nil
+	}
+	if len(procs) == 0 {
+		return 0, fmt.Errorf("no process matches")
+	}
+
+	var total float64
+	switch s.Config.Measure {
+	case "rss_mb":
+		for _, p := range procs {
+			if m, err := p.MemoryInfoWithContext(ctx); err == nil {
+				total += float64(m.RSS) / 1024 / 1024
+			}
+		}
+	case "fds":
+		for _, p := range procs {
+			n, err := p.NumFDsWithContext(ctx)
+			if err != nil {
+				// Other users' fd tables need root or CAP_SYS_PTRACE.
+				return 0, fmt.Errorf("pid %d: %w", p.Pid, err)
+			}
+			total += float64(n)
+		}
+	case "threads":
+		for _, p := range procs {
+			if n, err := p.NumThreadsWithContext(ctx); err == nil {
+				total += float64(n)
+			}
+		}
+	case "cpu_percent", "":
+		return s.processCPU(ctx, procs)
+	default:
+		return 0, fmt.Errorf("unknown process measure %q", s.Config.Measure)
+	}
+	return total, nil
+}
+
+// processFDValue is the fd type for processes: open descriptors against
+// their RLIMIT_NOFILE soft limit, which a process hits long before
+// fs.file-max. With several matches, used is the sum while max and
+// percent_used are those of the process closest to its limit.
+func processFDValue(ctx context.Context, c MetricConfig) (float64, error) {
+	procs, err := matchProcesses(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	if len(procs) == 0 {
+		return 0, fmt.Errorf("no process matches")
+	}
+	var used, worst, limit float64
+	for _, p := range procs {
+		n, err := p.NumFDsWithContext(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("pid %d: %w", p.Pid, err)
+		}
+		used += float64(n)
+		rlimits, err := p.RlimitWithContext(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("pid %d: %w", p.Pid, err)
+		}
+		for _, r := range rlimits {
+			if r.Resource != process.RLIMIT_NOFILE || r.Soft == 0 || r.Soft == math.MaxUint64 {
+				continue
+			}
+			if pct := float64(n) / float64(r.Soft) * 100; limit == 0 || pct > worst {
+				worst, limit = pct, float64(r.Soft)
+			}
+		}
+	}
+
+	switch c.Measure {
+	case "used", "":
+		return used, nil
+	case "max", "percent_used":
+		if limit == 0 {
+			return 0, fmt.Errorf("no open files limit")
+		}
+		if c.Measure == "max" {
+			return limit, nil
+		}
+		return worst, nil
+	}
+	return 0, fmt.Errorf("unknown fd measure %q", c.Measure)
+}
+
+// processCPU is the CPU time the matched processes used since the previous
+// sample, in percent of one core like container cpu_percent. It is tracked
+// per PID, so a worker exiting or a new one starting doesn't look like a
+// counter reset; processes started since the last sample count in full.
+func (s *MetricState) processCPU(ctx context.Context, procs []*process.Process) (float64, error) {
+	now := s.now()
+	prev, last := s.procCPU, s.LastTime
+	cur := make(map[int32]float64, len(procs))
+	var used float64
+	for _, p := range procs {
+		t, err := p.TimesWithContext(ctx)
+		if err != nil {
+			continue // Exited since it was listed
+		}
+		secs := t.User + t.System
+		cur[p.Pid] = secs
+		if before, ok := prev[p.Pid]; ok && secs >= before {
+			used += secs - before
+		} else if created, err := p.CreateTimeWithContext(ctx); err == nil && created > last.UnixMilli() {
+			used += secs
+		}
+	}
+	s.procCPU, s.LastTime = cur, now
+	if prev == nil {
+		return 0, errNotReady
+	}
+	elapsed := now.Sub(last)
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("time skew")
+	}
+	return used / elapsed.Seconds() * 100, nil
+}
+
+// matchProcesses lists the processes selected by c. Criteria combine: a
+// pidfile with a pattern only matches if that PID's command line fits.
+func matchProcesses(ctx context.Context, c MetricConfig) ([]*process.Process, error) {
+	if c.Process == "" && c.Pattern == "" && c.PidFile == "" {
+		return nil, fmt.Errorf("set process, pattern or pidfile")
+	}
+	var re *regexp.Regexp
+	if c.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(c.Pattern); err != nil {
+			return nil, fmt.Errorf("bad pattern: %w", err)
+		}
+	}
+
+	var candidates []*process.Process
+	if c.PidFile != "" {
+		data, err := os.ReadFile(c.PidFile)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: no PID: %w", c.PidFile, err)
+		}
+		// A stale pidfile just means nothing is running.
+		if p, err := process.NewProcessWithContext(ctx, int32(pid)); err == nil {
+			candidates = append(candidates, p)
+		}
+	} else {
+		var err error
+		if candidates, err = process.ProcessesWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var matched []*process.Process
+	for _, p := range candidates {
+		if c.Process != "" && !processNamed(ctx, p, c.Process) {
+			continue
+		}
+		if re != nil {
+			cmdline, err := p.CmdlineWithContext(ctx)
+			if err != nil || !re.MatchString(cmdline) {
+				continue
+			}
+		}
+		matched = append(matched, p)
+	}
+	return matched, nil
+}
+
+// processNamed compares name with the process's comm, which the kernel
+// cuts to 15 characters, and with its executable's base name.
+func processNamed(ctx context.Context, p *process.Process, name string) bool {
+	if comm, err := p.NameWithContext(ctx); err == nil && (comm == name || (len(comm) == 15 && strings.HasPrefix(name, comm))) {
+		return true
+	}
+	exe, err := p.ExeWithContext(ctx)
+	return err == nil && filepath.Base(exe) == name
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procStats is a single pass over /proc/<pid>/stat.
+type procStats struct {
+	Total   int
+	Running int
+	Zombie  int
+	DState  int // Uninterruptible sleep, usually stuck on I/O
+	Threads int
+}
+
+func readProcStats() (procStats, error) {
+	var st procStats
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return st, err
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			continue // Process exited between ReadDir and ReadFile
+		}
+		// The command name is wrapped in parens and may contain spaces,
+		// so fields are counted from the last ')'.
+		line := string(data)
+		end := strings.LastIndexByte(line, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(line[end+1:])
+		if len(fields) < 18 {
+			continue
+		}
+
+		st.Total++
+		switch fields[0] {
+		case "R":
+			st.Running++
+		case "Z":
+			st.Zombie++
+		case "D":
+			st.DState++
+		}
+		if n, err := strconv.Atoi(fields[17]); err == nil {
+			st.Threads += n
+		}
+	}
+	return st, nil
+}
+
+func procsValue(measure string) (float64, error) {
+	st, err := readProcStats()
+	if err != nil {
+		return 0, err
+	}
+	switch measure {
+	case "total", "":
+		return float64(st.Total), nil
+	case "running":
+		return float64(st.Running), nil
+	case "zombie":
+		return float64(st.Zombie), nil
+	case "d_state":
+		return float64(st.DState), nil
+	case "threads":
+		return float64(st.Threads), nil
+	}
+	return 0, fmt.Errorf("unknown procs measure %q", measure)
+}
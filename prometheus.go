@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Prometheus Exporter ---
+//
+// Serves the latest collected value of every metric (from the value cache,
+// so scrapes never trigger collection) in the Prometheus text format, plus
+// each value's age and the per-type collection time histograms. Values past
+// global.cache_ttl are left out, so a collector that stopped shows up as a
+// missing series rather than a frozen one.
+
+type PrometheusConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Listen string `yaml:"listen"` // e.g. "0.0.0.0:9102"
+	Path   string `yaml:"path"`   // Default "/metrics"
+}
+
+func startPrometheusServer(cfg *Config, states map[string]*MetricState) {
+	g, p := cfg.Global, cfg.Outputs.Prometheus
+	if p.Path == "" {
+		p.Path = "/metrics"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(p.Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, states)
+	})
+	srv := &http.Server{Addr: p.Listen, Handler: requireAuth(mux, g.HTTPBearerToken, g.HTTPUsername, g.HTTPPassword)}
+
+	go func() {
+		logInfof("Prometheus exporter listening on %s%s", p.Listen, p.Path)
+		if err := srv.ListenAndServe(); err != nil {
+			logErrorf("Prometheus exporter stopped: %v", err)
+		}
+	}()
+}
+
+type promSeries struct {
+	labels string
+	value  float64
+}
+
+type promFamily struct {
+	help   string
+	series []promSeries
+}
+
+func writePrometheus(w io.Writer, states map[string]*MetricState) {
+	families := map[string]*promFamily{}
+	var ages []promSeries
+
+	now := time.Now()
+	statesMu.RLock()
+	for _, s := range states {
+		cv, ok := metricCache.get(s.Name)
+		if !ok || metricCache.stale(cv, now) {
+			continue
+		}
+		family, labels := promName(s.family()), s.labels()
+		f := families[family]
+		if f == nil {
+			f = &promFamily{help: promHelp(s.Config)}
+			families[family] = f
+		}
+		f.series = append(f.series, promSeries{labels: promLabels(labels), value: cv.Value})
+		labels["metric"] = family
+		ages = append(ages, promSeries{labels: promLabels(labels), value: cv.age(now).Seconds()})
+	}
+	statesMu.RUnlock()
+
+	for _, name := range sortedKeys(families) {
+		f := families[name]
+		sort.Slice(f.series, func(i, j int) bool { return f.series[i].labels < f.series[j].labels })
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, f.help, name)
+		for _, s := range f.series {
+			fmt.Fprintf(w, "%s%s %s\n", name, s.labels, promFloat(s.value))
+		}
+	}
+
+	const age = "stat_monitor_sample_age_seconds"
+	fmt.Fprintf(w, "# HELP %s Time since each metric was last collected.\n# TYPE %s gauge\n", age, age)
+	sort.Slice(ages, func(i, j int) bool { return ages[i].labels < ages[j].labels })
+	for _, s := range ages {
+		fmt.Fprintf(w, "%s%s %s\n", age, s.labels, promFloat(s.value))
+	}
+
+	const hist = "stat_monitor_collect_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time spent collecting, by metric type.\n# TYPE %s histogram\n", hist, hist)
+	for _, typ := range sortedKeys(collectTimings) {
+		counts, count, sum := collectTimings[typ].snapshot()
+		for i, b := range collectBuckets {
+			fmt.Fprintf(w, "%s_bucket{type=%q,le=%q} %d\n", hist, typ, promFloat(b), counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{type=%q,le=\"+Inf\"} %d\n", hist, typ, counts[len(collectBuckets)])
+		fmt.Fprintf(w, "%s_sum{type=%q} %s\n", hist, typ, promFloat(sum))
+		fmt.Fprintf(w, "%s_count{type=%q} %d\n", hist, typ, count)
+	}
+}
+
+func promLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range sortedKeys(labels) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", k, promEscape(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// promName prefixes and sanitizes a metric key into a valid Prometheus name.
+func promName(key string) string {
+	var b strings.Builder
+	b.WriteString("stat_monitor_")
+	for _, r := range strings.TrimLeft(key, "_") {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func promHelp(c MetricConfig) string {
+	h := c.Type
+	if c.Measure != "" {
+		h += " " + c.Measure
+	}
+	if u := c.unit(); u != "" {
+		h += " (" + u + ")"
+	}
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(h)
+}
+
+func promEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func promFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
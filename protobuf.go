@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// --- Minimal Protobuf Encoding ---
+//
+// Just enough of the protobuf wire format for the messages in
+// proto/statmonitor.proto, without pulling in the protobuf runtime.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// The appendX helpers skip zero values, as proto3 does.
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func appendInt64(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return append(b, 1)
+}
+
+func appendMessage(b []byte, field int, msg []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+var errBadProto = errors.New("malformed protobuf message")
+
+// protoFields walks a message, calling fn with each field number, wire type
+// and payload (the raw value for varints, the contents for length-delimited
+// fields). Unknown fields are the caller's to ignore.
+func protoFields(b []byte, fn func(field, wire int, varint uint64, data []byte)) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errBadProto
+		}
+		b = b[n:]
+		field, wire := int(tag>>3), int(tag&7)
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errBadProto
+			}
+			b = b[n:]
+			fn(field, wire, v, nil)
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errBadProto
+			}
+			fn(field, wire, 0, b[:size])
+			b = b[size:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errBadProto
+			}
+			b = b[n:]
+			fn(field, wire, 0, b[:l])
+			b = b[l:]
+		default:
+			return errBadProto
+		}
+	}
+	return nil
+}
+
+// marshalSample encodes a Sample as statmonitor.Sample.
+func marshalSample(s Sample, snapshot bool) []byte {
+	var b []byte
+	b = appendString(b, 1, s.Name)
+	b = appendDouble(b, 2, s.Value)
+	b = appendInt64(b, 3, s.Time.UnixNano())
+	b = appendString(b, 4, s.Unit)
+	b = appendString(b, 5, s.Severity)
+	b = appendDouble(b, 6, s.Threshold)
+	b = appendString(b, 7, s.Message)
+	b = appendString(b, 8, s.Event)
+	b = appendString(b, 9, s.Error)
+	for _, name := range sortedKeys(s.Values) {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendDouble(entry, 2, s.Values[name])
+		b = appendMessage(b, 10, entry)
+	}
+	b = appendString(b, 11, s.Label)
+	b = appendBool(b, 12, snapshot)
+	return b
+}
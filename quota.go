@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --- Bandwidth Quota ---
+
+// quotaState is the persisted accumulator of a net_quota metric.
+type quotaState struct {
+	PeriodStart time.Time `json:"period_start"`
+	Bytes       float64   `json:"bytes"`
+}
+
+// quotaPeriodStart is the local-time start of the period containing t:
+// midnight for "daily", midnight on the 1st for "monthly" (the default).
+func quotaPeriodStart(t time.Time, period string) (time.Time, error) {
+	y, m, d := t.Date()
+	switch period {
+	case "daily":
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+	case "", "monthly":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location()), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown quota period %q (want daily or monthly)", period)
+}
+
+// quotaValue adds the traffic (rx+tx) since the previous sample to the
+// period's total and reports it as used_gb, or as used_percent of limit_gb.
+// The total is reset when a new period starts and kept across restarts in
+// global.state_file.
+func (s *MetricState) quotaValue(ctx context.Context) (float64, error) {
+	now := s.now()
+	start, err := quotaPeriodStart(now, s.Config.Period)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.quota == nil {
+		s.quota = &quotaState{}
+		persisted.get(s.Name, s.quota)
+	}
+	// Equal, not ==: the saved time comes back without its Location.
+	if !s.quota.PeriodStart.Equal(start) {
+		if !s.quota.PeriodStart.IsZero() {
+			logInfof("%s: new quota period from %s, resetting", s.Name, start.Format("2006-01-02"))
+		}
+		*s.quota = quotaState{PeriodStart: start}
+	}
+
+	c, _, err := netCounters(ctx, s.Config.Interface)
+	if err != nil {
+		return 0, err
+	}
+	// The first sample after startup (or a counter reset) only sets the
+	// baseline; unlike a rate, the accumulated total is still valid to report.
+	if delta, _, err := s.counterDelta(c.BytesRecv+c.BytesSent, now); err == nil {
+		s.quota.Bytes += delta
+	}
+	persisted.put(s.Name, s.quota)
+
+	usedGB := s.quota.Bytes / 1024 / 1024 / 1024
+	switch s.Config.Measure {
+	case "", "used_gb":
+		return usedGB, nil
+	case "used_percent":
+		if s.Config.LimitGB <= 0 {
+			return 0, fmt.Errorf("used_percent needs limit_gb")
+		}
+		return usedGB / s.Config.LimitGB * 100, nil
+	}
+	return 0, fmt.Errorf("unknown net_quota measure %q", s.Config.Measure)
+}
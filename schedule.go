@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// --- Quiet Hours ---
+
+// ScheduleConfig defines windows in which a metric only broadcasts crit
+// values and heartbeats.
+type ScheduleConfig struct {
+	Timezone string        `yaml:"timezone"` // IANA name, e.g. "Europe/Prague"; empty means local time
+	Quiet    []QuietWindow `yaml:"quiet"`
+}
+
+// QuietWindow is an HH:MM range on the given weekdays. A range whose end is
+// before its start runs past midnight and belongs to the day it starts on.
+type QuietWindow struct {
+	Days []string `yaml:"days"` // mon..sun; empty means every day
+	From string   `yaml:"from"` // "22:00"
+	To   string   `yaml:"to"`   // "06:00"; "24:00" for end of day
+}
+
+type quietWindow struct {
+	days     [7]bool // indexed by time.Weekday
+	from, to int     // minutes since midnight
+}
+
+type schedule struct {
+	loc     *time.Location
+	windows []quietWindow
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseSchedule validates a ScheduleConfig; it returns nil when no quiet
+// windows are configured.
+func parseSchedule(c ScheduleConfig) (*schedule, error) {
+	if len(c.Quiet) == 0 {
+		return nil, nil
+	}
+	sc := &schedule{loc: time.Local}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+		sc.loc = loc
+	}
+	for _, q := range c.Quiet {
+		var w quietWindow
+		var err error
+		if w.from, err = parseClock(q.From); err != nil {
+			return nil, err
+		}
+		if w.to, err = parseClock(q.To); err != nil {
+			return nil, err
+		}
+		if len(q.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, d := range q.Days {
+			wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+			if !ok {
+				return nil, fmt.Errorf("unknown weekday %q", d)
+			}
+			w.days[wd] = true
+		}
+		sc.windows = append(sc.windows, w)
+	}
+	return sc, nil
+}
+
+// parseClock turns "HH:MM" into minutes since midnight; "24:00" is allowed.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("bad time of day %q, want HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// quiet reports whether t falls inside any quiet window.
+func (sc *schedule) quiet(t time.Time) bool {
+	if sc == nil {
+		return false
+	}
+	t = t.In(sc.loc)
+	mins := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	for _, w := range sc.windows {
+		if w.from <= w.to {
+			if w.days[today] && mins >= w.from && mins < w.to {
+				return true
+			}
+			continue
+		}
+		// Crosses midnight: the evening part is today's, the morning part
+		// belongs to the window that started yesterday.
+		if (w.days[today] && mins >= w.from) || (w.days[yesterday] && mins < w.to) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// --- Self Metrics ---
+//
+// Internal health values (sink queue depth, drops, ...) are exposed as
+// regular metrics named "_self_<name>" so they flow through the same
+// diff/heartbeat logic and sinks as everything else.
+
+var (
+	selfMu      sync.Mutex
+	selfMetrics = map[string]func() float64{}
+)
+
+func registerSelfMetric(name string, fn func() float64) {
+	selfMu.Lock()
+	defer selfMu.Unlock()
+	selfMetrics["_self_"+name] = fn
+}
+
+func selfValue(name string) (float64, error) {
+	selfMu.Lock()
+	fn, ok := selfMetrics[name]
+	selfMu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("unknown self metric %q", name)
+	}
+	return fn(), nil
+}
+
+// addSelfStates creates a state for every registered self metric.
+func addSelfStates(states map[string]*MetricState) {
+	selfMu.Lock()
+	names := sortedKeys(selfMetrics)
+	selfMu.Unlock()
+
+	for _, name := range names {
+		states[name] = newMetricState(name, MetricConfig{
+			Type:           "self",
+			Measure:        name,
+			Diff:           1,
+			Interval:       10 * time.Second,
+			ResendInterval: 1 * time.Hour,
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// activeStates maps systemd's ActiveState to a number. active is 1 so the
+// default is-active reading and active_state agree on the healthy case.
+var activeStates = map[string]float64{
+	"inactive":     0,
+	"active":       1,
+	"reloading":    2,
+	"activating":   3,
+	"deactivating": 4,
+	"failed":       5,
+}
+
+// serviceValue reports on a systemd unit. The default measure is 1 when the
+// unit is active; the others read unit properties over D-Bus via systemctl.
+func serviceValue(ctx context.Context, unit, measure string) (float64, error) {
+	switch measure {
+	case "", "active":
+		if err := exec.CommandContext(ctx, "systemctl", "is-active", "--quiet", unit).Run(); err != nil {
+			return 0.0, nil
+		}
+		return 1.0, nil
+
+	case "failed":
+		state, err := unitProperty(ctx, unit, "ActiveState")
+		if err != nil {
+			return 0, err
+		}
+		if state == "failed" {
+			return 1, nil
+		}
+		return 0, nil
+
+	case "active_state":
+		state, err := unitProperty(ctx, unit, "ActiveState")
+		if err != nil {
+			return 0, err
+		}
+		v, ok := activeStates[state]
+		if !ok {
+			return 0, fmt.Errorf("unit %s: unknown ActiveState %q", unit, state)
+		}
+		return v, nil
+
+	case "n_restarts":
+		n, err := unitProperty(ctx, unit, "NRestarts")
+		if err != nil {
+			return 0, err
+		}
+		if n == "" {
+			return 0, fmt.Errorf("systemd too old for NRestarts: %w", errUnsupported)
+		}
+		return strconv.ParseFloat(n, 64)
+
+	default:
+		return 0, fmt.Errorf("unknown service measure %q", measure)
+	}
+}
+
+// failedUnits counts units in the failed state, optionally only those
+// matching pattern (a unit glob such as "*.service").
+func failedUnits(ctx context.Context, pattern string) (float64, error) {
+	path, err := exec.LookPath("systemctl")
+	if err != nil {
+		return 0, fmt.Errorf("no systemctl: %w", errUnsupported)
+	}
+	args := []string{"list-units", "--state=failed", "--all", "--no-legend", "--plain"}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+	out, err := exec.CommandContext(ctx, path, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		// e.g. "System has not been booted with systemd"
+		return 0, fmt.Errorf("systemctl list-units: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("systemctl list-units: %w", err)
+	}
+	var n float64
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// unitProperty reads one property of a unit with `systemctl show`.
+func unitProperty(ctx context.Context, unit, property string) (string, error) {
+	out, err := exec.CommandContext(ctx, "systemctl", "show", "--property="+property, "--value", unit).Output()
+	if err != nil {
+		return "", fmt.Errorf("systemctl show %s: %w", unit, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
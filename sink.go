@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// --- Sinks ---
+
+// Sample is a single broadcast value as handed to every sink.
+type Sample struct {
+	Name      string
+	Value     float64
+	Time      time.Time
+	Unit      string
+	Severity  string  // ok, warn, crit
+	Threshold float64 // Threshold for Severity (the warn level while ok)
+	Message   string  // Rendered message_template, empty for the default format
+	Label     string  // bool_format rendering of a 0/1 Value for text sinks, e.g. "up"
+
+	Tags map[string]string // What the metric watches (path, interface, core, ...) for tagged outputs
+
+	Values map[string]float64 // Only set on "summary" samples: every metric's last value
+
+	Event string // "error"/"recovered" for collection state changes, "escalated" for sustained warn/crit; empty for values
+	Error string // Collection error for "error" events, "<severity> for <duration>" for "escalated"
+}
+
+// sampleRecord is the JSON form of a Sample shared by the structured sinks
+// (file, mqtt, ...), so every destination sees the same field names.
+type sampleRecord struct {
+	Time     time.Time          `json:"time"`
+	Host     string             `json:"host"`
+	Name     string             `json:"name"`
+	Value    float64            `json:"value"`
+	Unit     string             `json:"unit,omitempty"`
+	Severity string             `json:"severity,omitempty"`
+	Tags     map[string]string  `json:"tags,omitempty"`
+	Values   map[string]float64 `json:"values,omitempty"`
+	Event    string             `json:"event,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+func newSampleRecord(s Sample) sampleRecord {
+	return sampleRecord{
+		Time:     s.Time,
+		Host:     hostName(),
+		Name:     s.Name,
+		Value:    s.Value,
+		Unit:     s.Unit,
+		Severity: s.Severity,
+		Tags:     s.Tags,
+		Values:   s.Values,
+		Event:    s.Event,
+		Error:    s.Error,
+	}
+}
+
+// Text is the human-readable form used by text sinks.
+func (s Sample) Text() string {
+	switch s.Event {
+	case "error":
+		return fmt.Sprintf("%s: ERROR: %s", s.Name, s.Error)
+	case "recovered":
+		return fmt.Sprintf("%s: RECOVERED", s.Name)
+	case "escalated":
+		return fmt.Sprintf("%s: ESCALATED: %s", s.Name, s.Error)
+	}
+	if s.Message != "" {
+		return s.Message
+	}
+	if s.Values != nil {
+		var b strings.Builder
+		b.WriteString(s.Name + ":")
+		for _, name := range sortedKeys(s.Values) {
+			fmt.Fprintf(&b, " %s=%.2f", name, s.Values[name])
+		}
+		return b.String()
+	}
+	if s.Label != "" {
+		return fmt.Sprintf("%s: %s", s.Name, s.Label)
+	}
+	return fmt.Sprintf("%s: %.2f", s.Name, s.Value)
+}
+
+// Sink is a broadcast destination. Name is what metrics list in `sinks:`.
+type Sink interface {
+	Name() string
+	Send(Sample) error
+}
+
+// sinks is the active fan-out list, built once in main.
+var sinks []Sink
+
+func setupSinks(cfg *Config) []Sink {
+	out := setupOutputs(cfg)
+
+	if cfg.Global.GRPCListen != "" {
+		grpcBroadcasts = newGRPCSink()
+		out = append(out, grpcBroadcasts)
+	}
+	if cfg.Global.HTTPWebSocket && cfg.Global.HTTPListen != "" {
+		wsBroadcasts = newWSSink()
+		out = append(out, wsBroadcasts)
+	}
+	return out
+}
+
+// wrapRemote puts a network-backed sink behind a bounded retry queue so a
+// slow or failing destination never blocks collection.
+func wrapRemote(sink Sink, cfg RetryConfig) Sink {
+	return newRetrySink(sink, cfg)
+}
+
+// reopenSinks is called on SIGHUP so file-backed sinks pick up a
+// freshly rotated file.
+func reopenSinks() {
+	for _, sink := range sinks {
+		if r, ok := sink.(interface{ Reopen() error }); ok {
+			if err := r.Reopen(); err != nil {
+				logErrorf("sink %s: reopen: %v", sink.Name(), err)
+			}
+		}
+	}
+}
+
+// broadcast fans the value out to every sink the metric routes to.
+func (s *MetricState) broadcast(value float64) {
+	s.send(s.sample(value))
+}
+
+// alert hands a severity change that wasn't broadcast to the alerting
+// sinks the metric routes to, which must not wait for the next heartbeat.
+func (s *MetricState) alert(value float64) {
+	sample := s.sample(value)
+	for _, sink := range sinks {
+		if !isAlertSink(sink) || !s.Config.routesTo(sink.Name()) {
+			continue
+		}
+		if err := sink.Send(sample); err != nil {
+			logErrorf("sink %s: %s: %v", sink.Name(), s.Name, err)
+		}
+	}
+}
+
+func (s *MetricState) sample(value float64) Sample {
+	sample := Sample{Name: s.Name, Value: value, Time: s.now(), Unit: s.Config.unit(), Tags: s.labels()}
+	sample.Severity, sample.Threshold = s.Severity, s.Config.thresholdFor(s.Severity)
+	sample.Label = s.Config.boolLabel(value)
+	if s.tmpl != nil {
+		sample.Message = s.renderMessage(sample)
+	}
+	return sample
+}
+
+// broadcastEvent reports a collection state change. The value carried is
+// the last broadcast value; Severity is "error" while the metric is failing.
+func (s *MetricState) broadcastEvent(event, errMsg string) {
+	sample := Sample{Name: s.Name, Value: s.LastValue, Time: s.now(), Unit: s.Config.unit(), Tags: s.labels(), Event: event, Error: errMsg}
+	if event == "error" {
+		sample.Severity = "error"
+	} else {
+		sample.Severity, sample.Threshold = s.Severity, s.Config.thresholdFor(s.Severity)
+	}
+	s.send(sample)
+}
+
+func (s *MetricState) send(sample Sample) {
+	for _, sink := range sinks {
+		if !s.Config.routesTo(sink.Name()) {
+			continue
+		}
+		if err := sink.Send(sample); err != nil {
+			logErrorf("sink %s: %s: %v", sink.Name(), s.Name, err)
+		}
+	}
+}
+
+// routesTo reports whether samples of this metric go to the named sink.
+// An empty or omitted list means all sinks.
+func (c MetricConfig) routesTo(sink string) bool {
+	if len(c.Sinks) == 0 {
+		return true
+	}
+	for _, name := range c.Sinks {
+		if name == sink {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSinkRoutes warns about sink names that don't match any configured
+// sink, since such a metric would silently never be sent there.
+func validateSinkRoutes(states map[string]*MetricState) {
+	known := make(map[string]bool, len(sinks))
+	for _, sink := range sinks {
+		known[sink.Name()] = true
+	}
+	for _, key := range sortedKeys(states) {
+		s := states[key]
+		for _, name := range s.Config.Sinks {
+			if !known[name] {
+				logWarnf("metric %s routes to unknown sink %q", s.Name, name)
+			}
+		}
+	}
+}
+
+// --- Log Sink ---
+
+type logSink struct{}
+
+func (logSink) Name() string { return "log" }
+
+func (logSink) Send(s Sample) error {
+	log.Printf("[BROADCAST] %s\n", s.Text())
+	return nil
+}
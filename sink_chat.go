@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// --- Chat Webhook Sinks (Slack, Discord, Teams) ---
+//
+// Post threshold alerts (see alert.go) to a chat channel through its
+// incoming webhook. Each service gets the same title and message, colored
+// by severity, in its own payload format. Since a webhook belongs to one
+// channel, routing a metric elsewhere means giving it another URL.
+
+type ChatConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	URL     string               `yaml:"url"`     // Incoming webhook URL
+	Title   string               `yaml:"title"`   // Template, see alertData
+	Message string               `yaml:"message"` // Template, see alertData
+	Metrics map[string]ChatRoute `yaml:"metrics"` // Per-metric overrides, keyed by metric name
+	Timeout time.Duration        `yaml:"timeout"` // Per request, default 10s
+}
+
+// ChatRoute overrides the output's settings for one metric.
+type ChatRoute struct {
+	URL     string `yaml:"url"`
+	Title   string `yaml:"title"`
+	Message string `yaml:"message"`
+}
+
+type chatRoute struct {
+	url            string
+	title, message *template.Template
+}
+
+type chatSink struct {
+	name    string // slack, discord or teams
+	def     chatRoute
+	metrics map[string]chatRoute
+	client  *http.Client
+	alerts  *alertTracker
+}
+
+// Severity colors: red, amber, green.
+var chatColors = map[string]int{"crit": 0xd00000, "warn": 0xf0a000, "ok": 0x2eb886}
+
+func newChatSink(name string, cfg ChatConfig) (*chatSink, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	c := &chatSink{
+		name:    name,
+		metrics: map[string]chatRoute{},
+		client:  &http.Client{Timeout: cfg.Timeout},
+		alerts:  newAlertTracker(),
+	}
+	var err error
+	if c.def, err = newChatRoute(chatRoute{}, ChatRoute{cfg.URL, cfg.Title, cfg.Message}); err != nil {
+		return nil, err
+	}
+	for metric, r := range cfg.Metrics {
+		if c.metrics[metric], err = newChatRoute(c.def, r); err != nil {
+			return nil, fmt.Errorf("metrics.%s: %w", metric, err)
+		}
+		if c.metrics[metric].url == "" {
+			return nil, fmt.Errorf("metrics.%s: no url", metric)
+		}
+	}
+	return c, nil
+}
+
+// newChatRoute applies r on top of base.
+func newChatRoute(base chatRoute, r ChatRoute) (chatRoute, error) {
+	out := base
+	if r.URL != "" {
+		if _, err := http.NewRequest(http.MethodPost, r.URL, nil); err != nil {
+			return out, err
+		}
+		out.url = r.URL
+	}
+	var err error
+	if r.Title != "" || out.title == nil {
+		if out.title, err = parseAlertTemplate("title", r.Title, defaultAlertTitle); err != nil {
+			return out, err
+		}
+	}
+	if r.Message != "" || out.message == nil {
+		if out.message, err = parseAlertTemplate("message", r.Message, defaultAlertMessage); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func (c *chatSink) Name() string { return c.name }
+
+func (*chatSink) alerting() {}
+
+func (c *chatSink) Send(s Sample) error {
+	prev, ok := c.alerts.check(s)
+	if !ok {
+		return nil
+	}
+	r, ok := c.metrics[s.Name]
+	if !ok {
+		if c.def.url == "" {
+			return nil // Only the listed metrics alert here
+		}
+		r = c.def
+	}
+	d := newAlertData(s, prev)
+	title, err := renderAlert(r.title, d)
+	if err != nil {
+		return fmt.Errorf("title: %w", err)
+	}
+	message, err := renderAlert(r.message, d)
+	if err != nil {
+		return fmt.Errorf("message: %w", err)
+	}
+
+	var payload any
+	color := chatColors[s.Severity]
+	switch c.name {
+	case "slack":
+		payload = map[string]any{
+			"text": title, // Shown in notifications
+			"attachments": []map[string]any{{
+				"color": fmt.Sprintf("#%06x", color),
+				"title": title,
+				"text":  message,
+				"ts":    s.Time.Unix(),
+			}},
+		}
+	case "discord":
+		payload = map[string]any{
+			"embeds": []map[string]any{{
+				"title":       title,
+				"description": message,
+				"color":       color,
+				"timestamp":   s.Time.UTC().Format(time.RFC3339),
+			}},
+		}
+	case "teams":
+		// An Adaptive Card, which both Workflows and the older connector
+		// webhooks accept.
+		textColor := map[string]string{"crit": "Attention", "warn": "Warning", "ok": "Good"}[s.Severity]
+		payload = map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]any{
+						{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "color": textColor, "wrap": true},
+						{"type": "TextBlock", "text": message, "wrap": true},
+					},
+				},
+			}},
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := httpSend(c.client, http.MethodPost, r.url, "application/json", nil, body); err != nil {
+		return err
+	}
+	c.alerts.record(s)
+	return nil
+}
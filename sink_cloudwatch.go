@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- AWS CloudWatch Sink ---
+//
+// Sends broadcasts as PutMetricData calls (query API, signed with SigV4).
+// Samples are batched by the retry queue: it collects them for
+// flush_interval and hands over up to cloudwatchMaxDatums per call.
+// Credentials come from the config, the standard AWS_* environment
+// variables, or the EC2 instance role via IMDSv2, in that order.
+
+type CloudWatchConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Namespace       string            `yaml:"namespace"`        // e.g. "StatMonitor"
+	Region          string            `yaml:"region"`           // Default AWS_REGION, then the instance's region
+	Dimensions      map[string]string `yaml:"dimensions"`       // Default {Host: "{host}"}
+	LabelDimensions bool              `yaml:"label_dimensions"` // Add the metric's labels (path, interface, ...) as dimensions
+	FlushInterval   time.Duration     `yaml:"flush_interval"`   // Batch window, default 1m
+	AccessKeyID     string            `yaml:"access_key_id"`
+	SecretAccessKey string            `yaml:"secret_access_key"`
+	Endpoint        string            `yaml:"endpoint"` // Override, e.g. for a VPC endpoint or LocalStack
+}
+
+const (
+	cloudwatchMaxDatums = 1000 // PutMetricData limit per call
+	imdsEndpoint        = "http://169.254.169.254"
+)
+
+type awsCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+type cloudwatchSink struct {
+	cfg    CloudWatchConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	creds awsCredentials
+}
+
+func newCloudWatchSink(cfg CloudWatchConfig) (*cloudwatchSink, error) {
+	if cfg.Namespace == "" {
+		return nil, errors.New("namespace is required")
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Minute
+	}
+	if cfg.Dimensions == nil {
+		cfg.Dimensions = map[string]string{"Host": "{host}"}
+	}
+	c := &cloudwatchSink{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+	if c.cfg.Region == "" {
+		c.cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if c.cfg.Region == "" {
+		c.cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.cfg.Region == "" {
+		region, err := c.imdsGet("/latest/meta-data/placement/region")
+		if err != nil {
+			return nil, fmt.Errorf("region not set and not on EC2: %w", err)
+		}
+		c.cfg.Region = region
+	}
+	if c.cfg.Endpoint == "" {
+		c.cfg.Endpoint = "https://monitoring." + c.cfg.Region + ".amazonaws.com"
+	}
+	if _, err := url.Parse(c.cfg.Endpoint); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *cloudwatchSink) Name() string { return "cloudwatch" }
+
+func (c *cloudwatchSink) Send(s Sample) error {
+	return c.SendBatch([]Sample{s})
+}
+
+func (c *cloudwatchSink) batchLimits() (int, time.Duration) {
+	return cloudwatchMaxDatums, c.cfg.FlushInterval
+}
+
+func (c *cloudwatchSink) SendBatch(samples []Sample) error {
+	form := url.Values{"Action": {"PutMetricData"}, "Version": {"2010-08-01"}, "Namespace": {c.cfg.Namespace}}
+	n := 0
+	for _, s := range samples {
+		// Events and summaries repeat values CloudWatch already has.
+		if s.Event != "" || s.Values != nil {
+			continue
+		}
+		n++
+		p := fmt.Sprintf("MetricData.member.%d.", n)
+		form.Set(p+"MetricName", s.Name)
+		form.Set(p+"Value", strconv.FormatFloat(s.Value, 'g', -1, 64))
+		form.Set(p+"Unit", cloudwatchUnit(s.Unit))
+		form.Set(p+"Timestamp", s.Time.UTC().Format(time.RFC3339))
+		for i, d := range c.dimensions(s) {
+			form.Set(fmt.Sprintf("%sDimensions.member.%d.Name", p, i+1), d[0])
+			form.Set(fmt.Sprintf("%sDimensions.member.%d.Value", p, i+1), d[1])
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	creds, err := c.credentials()
+	if err != nil {
+		return err
+	}
+	body := form.Encode()
+	req, err := http.NewRequest(http.MethodPost, c.cfg.Endpoint+"/", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, []byte(body), creds, c.cfg.Region, "monitoring", time.Now())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
+			c.mu.Lock()
+			c.creds = awsCredentials{} // Maybe rotated; fetch again next time
+			c.mu.Unlock()
+		}
+		return fmt.Errorf("PutMetricData: %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// dimensions returns the configured dimensions, plus the metric's labels
+// with label_dimensions, as sorted name/value pairs (CloudWatch allows 30).
+func (c *cloudwatchSink) dimensions(s Sample) [][2]string {
+	dims := map[string]string{}
+	for k, v := range c.cfg.Dimensions {
+		dims[k] = expandName(v, s.Name)
+	}
+	if c.cfg.LabelDimensions {
+		for k, v := range s.Tags {
+			dims[k] = v
+		}
+	}
+	var out [][2]string
+	for _, k := range sortedKeys(dims) {
+		if dims[k] != "" && len(out) < 30 {
+			out = append(out, [2]string{k, dims[k]})
+		}
+	}
+	return out
+}
+
+// cloudwatchUnit maps our units to CloudWatch's StandardUnit names.
+func cloudwatchUnit(unit string) string {
+	switch unit {
+	case "%":
+		return "Percent"
+	case "bytes":
+		return "Bytes"
+	case "MB":
+		return "Megabytes"
+	case "GB":
+		return "Gigabytes"
+	case "Mbps":
+		return "Megabits/Second"
+	case "ms":
+		return "Milliseconds"
+	case "s":
+		return "Seconds"
+	}
+	return "None"
+}
+
+func (c *cloudwatchSink) credentials() (awsCredentials, error) {
+	if c.cfg.AccessKeyID != "" {
+		return awsCredentials{AccessKeyID: c.cfg.AccessKeyID, SecretAccessKey: c.cfg.SecretAccessKey}, nil
+	}
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), Token: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Instance role credentials rotate; refresh well before they expire.
+	if c.creds.AccessKeyID != "" && time.Until(c.creds.Expiration) > 5*time.Minute {
+		return c.creds, nil
+	}
+	role, err := c.imdsGet("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("no credentials configured and no instance role: %w", err)
+	}
+	role, _, _ = strings.Cut(strings.TrimSpace(role), "\n")
+	doc, err := c.imdsGet("/latest/meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var creds awsCredentials
+	if err := json.Unmarshal([]byte(doc), &creds); err != nil {
+		return awsCredentials{}, fmt.Errorf("instance credentials: %w", err)
+	}
+	if creds.AccessKeyID == "" {
+		return awsCredentials{}, errors.New("instance credentials: empty response")
+	}
+	c.creds = creds
+	return creds, nil
+}
+
+// imdsGet reads an instance metadata path using an IMDSv2 session token.
+func (c *cloudwatchSink) imdsGet(path string) (string, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	req, _ := http.NewRequest(http.MethodPut, imdsEndpoint+"/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	token, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IMDS token: %s", resp.Status)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, imdsEndpoint+path, nil)
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	resp, err = client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IMDS %s: %s", path, resp.Status)
+	}
+	return string(body), nil
+}
+
+// signV4 adds AWS Signature Version 4 headers to req.
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+	payloadHash := sha256Hex(body)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
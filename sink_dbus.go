@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- D-Bus Sink ---
+//
+// Emits every broadcast as a D-Bus signal. The connection, SASL EXTERNAL
+// handshake and message marshalling are done here; only the handful of
+// types the signal uses are supported.
+//
+//	interface io.github.adam_skalicky.StatMonitor
+//	signal Broadcast(s name, d value, x time_unix_nano, s unit,
+//	                 s severity, s event, s text)
+
+type DBusConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Bus string `yaml:"bus"` // system, session, or a bus address such as unix:path=/run/dbus/system_bus_socket
+}
+
+const (
+	dbusInterface  = "io.github.adam_skalicky.StatMonitor"
+	dbusObjectPath = "/io/github/adam_skalicky/StatMonitor"
+	dbusSignal     = "Broadcast"
+	dbusBodySig    = "sdxssss"
+	dbusTimeout    = 10 * time.Second
+)
+
+// D-Bus message types and header field codes used here.
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignalMsg    = 4
+
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+)
+
+type dbusSink struct {
+	network, addr string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	serial uint32
+}
+
+func newDBusSink(cfg DBusConfig) (*dbusSink, error) {
+	address := cfg.Bus
+	switch address {
+	case "", "system":
+		address = os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+		if address == "" {
+			address = "unix:path=/run/dbus/system_bus_socket"
+		}
+	case "session":
+		address = os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+		if address == "" {
+			return nil, errors.New("bus: session, but DBUS_SESSION_BUS_ADDRESS is not set")
+		}
+	}
+	network, addr, err := parseDBusAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return &dbusSink{network: network, addr: addr}, nil
+}
+
+// parseDBusAddress takes the first usable unix: entry of a bus address
+// list, e.g. "unix:path=/run/user/1000/bus" or "unix:abstract=/tmp/dbus-x".
+func parseDBusAddress(address string) (string, string, error) {
+	for _, entry := range strings.Split(address, ";") {
+		params, ok := strings.CutPrefix(entry, "unix:")
+		if !ok {
+			continue
+		}
+		for _, kv := range strings.Split(params, ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			switch k {
+			case "path":
+				return "unix", v, nil
+			case "abstract":
+				return "unix", "@" + v, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no supported unix: transport in bus address %q", address)
+}
+
+func (d *dbusSink) Name() string { return "dbus" }
+
+func (d *dbusSink) Send(s Sample) error {
+	var body []byte
+	body = dbusString(body, s.Name)
+	body = dbusAlign(body, 8)
+	body = binary.LittleEndian.AppendUint64(body, math.Float64bits(s.Value))
+	body = binary.LittleEndian.AppendUint64(body, uint64(s.Time.UnixNano()))
+	body = dbusString(body, s.Unit)
+	body = dbusString(body, s.Severity)
+	body = dbusString(body, s.Event)
+	body = dbusString(body, s.Text())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn == nil {
+		if err := d.connect(); err != nil {
+			return err
+		}
+	}
+	msg := d.message(dbusSignalMsg, []dbusField{
+		{dbusFieldPath, dbusObjectPath},
+		{dbusFieldInterface, dbusInterface},
+		{dbusFieldMember, dbusSignal},
+		{dbusFieldSignature, dbusBodySig},
+	}, body)
+	d.conn.SetWriteDeadline(time.Now().Add(dbusTimeout))
+	if _, err := d.conn.Write(msg); err != nil {
+		d.conn.Close()
+		d.conn = nil
+		return err
+	}
+	return nil
+}
+
+// connect authenticates with SASL EXTERNAL (our uid) and registers with
+// the bus through the mandatory Hello call.
+func (d *dbusSink) connect() error {
+	conn, err := net.DialTimeout(d.network, d.addr, dbusTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(dbusTimeout))
+	r := bufio.NewReader(conn)
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		conn.Close()
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("auth: %w", err)
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		conn.Close()
+		return fmt.Errorf("auth rejected: %s", strings.TrimSpace(line))
+	}
+
+	d.serial = 0
+	hello := d.message(dbusMethodCall, []dbusField{
+		{dbusFieldPath, "/org/freedesktop/DBus"},
+		{dbusFieldInterface, "org.freedesktop.DBus"},
+		{dbusFieldMember, "Hello"},
+		{dbusFieldDestination, "org.freedesktop.DBus"},
+	}, nil)
+	if _, err := conn.Write(append([]byte("BEGIN\r\n"), hello...)); err != nil {
+		conn.Close()
+		return err
+	}
+	typ, err := readDBusMessage(r)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Hello: %w", err)
+	}
+	if typ == dbusError {
+		conn.Close()
+		return errors.New("bus refused Hello")
+	}
+	// Nothing else is read: without match rules the bus only sends us the
+	// NameAcquired signal, which fits in the socket buffer.
+	conn.SetDeadline(time.Time{})
+	d.conn = conn
+	return nil
+}
+
+// dbusField is a header field; its D-Bus type follows from the code.
+type dbusField struct {
+	code  byte
+	value string
+}
+
+// message builds a little-endian message with the given header fields.
+func (d *dbusSink) message(typ byte, fields []dbusField, body []byte) []byte {
+	d.serial++
+	b := []byte{'l', typ, 0, 1}
+	if typ == dbusSignalMsg {
+		b[2] = 0x01 // NO_REPLY_EXPECTED
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)))
+	b = binary.LittleEndian.AppendUint32(b, d.serial)
+
+	var arr []byte
+	for _, f := range fields {
+		// Each field is a struct, aligned to 8. The array starts at offset
+		// 16, so aligning within it is the same.
+		arr = dbusAlign(arr, 8)
+		arr = append(arr, f.code)
+		switch f.code {
+		case dbusFieldPath:
+			arr = dbusSignature(arr, "o")
+			arr = dbusString(arr, f.value)
+		case dbusFieldSignature:
+			arr = dbusSignature(arr, "g")
+			arr = dbusSignature(arr, f.value)
+		default:
+			arr = dbusSignature(arr, "s")
+			arr = dbusString(arr, f.value)
+		}
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(arr)))
+	b = append(b, arr...)
+	b = dbusAlign(b, 8)
+	return append(b, body...)
+}
+
+// readDBusMessage reads one message and returns its type.
+func readDBusMessage(r *bufio.Reader) (byte, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	order := binary.ByteOrder(binary.LittleEndian)
+	if hdr[0] == 'B' {
+		order = binary.BigEndian
+	}
+	bodyLen, fieldsLen := order.Uint32(hdr[4:8]), order.Uint32(hdr[12:16])
+	if bodyLen > 1<<20 || fieldsLen > 1<<20 {
+		return 0, errors.New("message too large")
+	}
+	rest := (int64(fieldsLen)+7)&^7 + int64(bodyLen)
+	_, err := io.CopyN(io.Discard, r, rest)
+	return hdr[1], err
+}
+
+func dbusAlign(b []byte, n int) []byte {
+	for len(b)%n != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// dbusString appends a string or object path, aligned to 4.
+func dbusString(b []byte, s string) []byte {
+	b = dbusAlign(b, 4)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	b = append(b, s...)
+	return append(b, 0)
+}
+
+func dbusSignature(b []byte, s string) []byte {
+	b = append(b, byte(len(s)))
+	b = append(b, s...)
+	return append(b, 0)
+}
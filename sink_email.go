@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// --- Email Sink ---
+//
+// Mails threshold alerts (see alert.go) over SMTP, with STARTTLS or
+// implicit TLS and optional authentication. Two limits keep a flapping
+// metric from flooding inboxes: one mail per metric per min_interval, and
+// max_per_hour overall. Alerts over a limit are dropped and summarized in
+// the next mail that goes out.
+
+type EmailConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Server      string        `yaml:"server"`       // host:port; port defaults to 587, or 465 with tls: tls
+	TLS         string        `yaml:"tls"`          // starttls (default), tls, or none
+	Username    string        `yaml:"username"`     // Enables AUTH PLAIN (needs TLS unless the server is local)
+	Password    string        `yaml:"password"`     // Sent only over TLS, or to a local server
+	From        string        `yaml:"from"`         // Default stat-monitor@<hostname>
+	To          []string      `yaml:"to"`           // Recipients
+	Subject     string        `yaml:"subject"`      // Template, see alertData
+	Body        string        `yaml:"body"`         // Template, see alertData
+	MinInterval time.Duration `yaml:"min_interval"` // Per metric, default 15m
+	MaxPerHour  int           `yaml:"max_per_hour"` // Overall, default 20
+	Timeout     time.Duration `yaml:"timeout"`      // Per delivery, default 30s
+}
+
+const defaultEmailBody = `{{.Text}}
+
+Host:      {{.Host}}
+Metric:    {{.Name}}
+Severity:  {{.Previous}} -> {{.Severity}}
+Value:     {{.Value}} {{.Unit}}
+Threshold: {{.Threshold}}
+Time:      {{.Time.Format "2006-01-02 15:04:05 MST"}}
+`
+
+type emailSink struct {
+	cfg           EmailConfig
+	host          string // Server name for TLS and auth
+	subject, body *template.Template
+	alerts        *alertTracker
+
+	mu         sync.Mutex
+	lastMetric map[string]time.Time // Last mail per metric
+	recent     []time.Time          // Mails in the last hour
+	suppressed map[string]int       // Dropped alerts per metric since the last mail
+}
+
+func newEmailSink(cfg EmailConfig) (*emailSink, error) {
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown tls %q (starttls, tls or none)", cfg.TLS)
+	}
+	if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+		port := "587"
+		if cfg.TLS == "tls" {
+			port = "465"
+		}
+		cfg.Server = net.JoinHostPort(cfg.Server, port)
+	}
+	host, _, _ := net.SplitHostPort(cfg.Server)
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("no recipients (to)")
+	}
+	if cfg.From == "" {
+		cfg.From = "stat-monitor@" + hostName()
+	}
+	if cfg.MinInterval == 0 {
+		cfg.MinInterval = 15 * time.Minute
+	}
+	if cfg.MaxPerHour <= 0 {
+		cfg.MaxPerHour = 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	subject, err := parseAlertTemplate("subject", cfg.Subject, defaultAlertTitle)
+	if err != nil {
+		return nil, err
+	}
+	body, err := parseAlertTemplate("body", cfg.Body, defaultEmailBody)
+	if err != nil {
+		return nil, err
+	}
+	return &emailSink{
+		cfg:        cfg,
+		host:       host,
+		subject:    subject,
+		body:       body,
+		alerts:     newAlertTracker(),
+		lastMetric: map[string]time.Time{},
+		suppressed: map[string]int{},
+	}, nil
+}
+
+func (e *emailSink) Name() string { return "email" }
+
+func (*emailSink) alerting() {}
+
+func (e *emailSink) Send(s Sample) error {
+	prev, ok := e.alerts.check(s)
+	if !ok {
+		return nil
+	}
+	if !e.allow(s.Name) {
+		logWarnf("sink email: %s %s not mailed, rate limited", s.Name, s.Severity)
+		e.alerts.record(s)
+		return nil
+	}
+
+	d := newAlertData(s, prev)
+	subject, err := renderAlert(e.subject, d)
+	if err != nil {
+		return fmt.Errorf("subject: %w", err)
+	}
+	body, err := renderAlert(e.body, d)
+	if err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	e.mu.Lock()
+	suppressed := maps.Clone(e.suppressed)
+	e.mu.Unlock()
+	if len(suppressed) > 0 {
+		var names []string
+		for name, n := range suppressed {
+			names = append(names, fmt.Sprintf("%s (%d)", name, n))
+		}
+		sort.Strings(names)
+		body += "\nNot mailed since the last alert (rate limited): " + strings.Join(names, ", ") + "\n"
+	}
+
+	if err := e.deliver(subject, body); err != nil {
+		e.unsend(s.Name)
+		return err
+	}
+	e.mu.Lock()
+	for name, n := range suppressed {
+		if e.suppressed[name] -= n; e.suppressed[name] <= 0 {
+			delete(e.suppressed, name)
+		}
+	}
+	e.mu.Unlock()
+	e.alerts.record(s)
+	return nil
+}
+
+// allow applies the rate limits, counting the mail as sent when it passes.
+func (e *emailSink) allow(metric string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	for len(e.recent) > 0 && now.Sub(e.recent[0]) >= time.Hour {
+		e.recent = e.recent[1:]
+	}
+	if last, ok := e.lastMetric[metric]; (ok && now.Sub(last) < e.cfg.MinInterval) || len(e.recent) >= e.cfg.MaxPerHour {
+		e.suppressed[metric]++
+		return false
+	}
+	e.lastMetric[metric] = now
+	e.recent = append(e.recent, now)
+	return true
+}
+
+// unsend takes back what allow counted when delivery fails, so the retry
+// isn't rate limited by its own failed attempt.
+func (e *emailSink) unsend(metric string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.lastMetric, metric)
+	if len(e.recent) > 0 {
+		e.recent = e.recent[:len(e.recent)-1]
+	}
+}
+
+func (e *emailSink) deliver(subject, body string) error {
+	dialer := &net.Dialer{Timeout: e.cfg.Timeout}
+	tlsConfig := &tls.Config{ServerName: e.host}
+	var conn net.Conn
+	var err error
+	if e.cfg.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.cfg.Server, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", e.cfg.Server)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(e.cfg.Timeout))
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello(hostName()); err != nil {
+		return err
+	}
+	if e.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not offer STARTTLS (set tls: none to send in the clear)", e.cfg.Server)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(addrSpec(e.cfg.From)); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		if err := c.Rcpt(addrSpec(to)); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.message(subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message builds a plain-text mail, quoted-printable so any line length
+// and character set survives.
+func (e *emailSink) message(subject, body string) []byte {
+	id := make([]byte, 12)
+	rand.Read(id)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), hostName())
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+	return b.Bytes()
+}
+
+// addrSpec strips a display name: "Ops <ops@example.com>" -> ops@example.com.
+func addrSpec(addr string) string {
+	if a, err := mail.ParseAddress(addr); err == nil {
+		return a.Address
+	}
+	return addr
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --- Exec Sink ---
+//
+// Runs a command for every broadcast, for destinations nothing else here
+// speaks. The command runs through the shell like on_warn/on_crit and gets
+// the broadcast as JSON on stdin, or as positional parameters ($1 name,
+// $2 value, $3 unit, $4 severity, $5 event, $6 text). SM_* environment
+// variables are set either way. Runs are detached from collection and
+// capped at max_concurrent; broadcasts arriving while every slot is busy
+// are dropped and counted in _self_exec_dropped.
+
+type ExecOutputConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Command       string        `yaml:"command"`        // Run with sh -c
+	Input         string        `yaml:"input"`          // json (default, on stdin) or args
+	MaxConcurrent int           `yaml:"max_concurrent"` // Default 4
+	Timeout       time.Duration `yaml:"timeout"`        // Per run, default 10s
+}
+
+type execSink struct {
+	cmd     *execCommand
+	slots   chan struct{}
+	dropped atomic.Uint64
+}
+
+// execCommand runs the command synchronously; -test-sinks uses it directly
+// so failures are reported.
+type execCommand struct {
+	cfg ExecOutputConfig
+}
+
+func newExecSink(cfg ExecOutputConfig) (*execSink, error) {
+	switch cfg.Input {
+	case "":
+		cfg.Input = "json"
+	case "json", "args":
+	default:
+		return nil, fmt.Errorf("unknown input %q (json or args)", cfg.Input)
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 4
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	e := &execSink{cmd: &execCommand{cfg: cfg}, slots: make(chan struct{}, cfg.MaxConcurrent)}
+	registerSelfMetric("exec_dropped", func() float64 { return float64(e.dropped.Load()) })
+	return e, nil
+}
+
+func (e *execSink) Name() string { return "exec" }
+
+// Unwrap returns the synchronous command, bypassing the slots.
+func (e *execSink) Unwrap() Sink { return e.cmd }
+
+func (e *execSink) Send(s Sample) error {
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		e.dropped.Add(1)
+		return fmt.Errorf("all %d runs busy, dropped", cap(e.slots))
+	}
+	go func() {
+		defer func() { <-e.slots }()
+		if err := e.cmd.Send(s); err != nil {
+			logErrorf("sink exec: %s: %v", s.Name, err)
+		}
+	}()
+	return nil
+}
+
+func (c *execCommand) Name() string { return "exec" }
+
+func (c *execCommand) Send(s Sample) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	value := strconv.FormatFloat(s.Value, 'f', -1, 64)
+	var cmd *exec.Cmd
+	if c.cfg.Input == "args" {
+		// After -c, the next argument is $0.
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.cfg.Command, "stat-monitor",
+			s.Name, value, s.Unit, s.Severity, s.Event, s.Text())
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.cfg.Command)
+		body, err := json.Marshal(webhookBody{sampleRecord: newSampleRecord(s), Text: s.Text()})
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	}
+	cmd.Env = append(os.Environ(),
+		"SM_METRIC="+s.Name,
+		"SM_VALUE="+value,
+		"SM_UNIT="+s.Unit,
+		"SM_SEVERITY="+s.Severity,
+		"SM_EVENT="+s.Event,
+	)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s", c.cfg.Timeout)
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("exited with status %d: %s", exitErr.ExitCode(), output)
+	case err != nil:
+		return err
+	}
+	if output != "" {
+		logDebugf("sink exec: %s: %s", s.Name, output)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// --- File Sink ---
+
+type FileOutputConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Path       string        `yaml:"path"`
+	MaxSizeMB  int           `yaml:"max_size_mb"` // Rotate when the file would exceed this size; 0 disables size rotation
+	MaxAge     time.Duration `yaml:"max_age"`     // Rotate once the file's first record is older than this; 0 disables
+	MaxBackups int           `yaml:"max_backups"` // Number of rotated files (path.1, path.2, ...) to keep
+	Retention  time.Duration `yaml:"retention"`   // Also delete rotated files last written longer ago than this
+}
+
+// fileSink writes one JSON object per broadcast and rotates by size and
+// age. Reopen (SIGHUP) lets an external logrotate move the file underneath us.
+// A failed reopen keeps the old handle; a failed open after rotation leaves
+// no handle, and every Send tries to open the file again until it works.
+type fileSink struct {
+	cfg     FileOutputConfig
+	mu      sync.Mutex
+	f       *os.File // nil while the file can't be opened
+	size    int64
+	started time.Time // Time of the first record in the live file
+}
+
+func newFileSink(cfg FileOutputConfig) (*fileSink, error) {
+	s := &fileSink{cfg: cfg}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Name() string { return "file" }
+
+func (s *fileSink) Send(sample Sample) error {
+	line, err := json.Marshal(newSampleRecord(sample))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	tooBig := s.cfg.MaxSizeMB > 0 && s.size+int64(len(line)) > int64(s.cfg.MaxSizeMB)*1024*1024
+	tooOld := s.cfg.MaxAge > 0 && s.size > 0 && sample.Time.Sub(s.started) >= s.cfg.MaxAge
+	if tooBig || tooOld {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.size == 0 {
+		s.started = sample.Time
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Reopen reopens the file at the configured path.
+func (s *fileSink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open()
+}
+
+// open opens the file at the configured path and, once that has worked,
+// closes the previous handle. Expired backups are pruned on every open
+// (startup, SIGHUP, rotation), so a file that stops rotating doesn't keep
+// them forever.
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if s.f != nil {
+		s.f.Close()
+	}
+	s.f = f
+	s.size = info.Size()
+	s.started = time.Now()
+	if s.size > 0 {
+		s.started = firstRecordTime(s.cfg.Path, info.ModTime())
+	}
+	s.expireBackups()
+	return nil
+}
+
+// firstRecordTime reads the time of the first line of an existing file, so
+// age-based rotation survives restarts. fallback is used if it can't be read.
+func firstRecordTime(path string, fallback time.Time) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return fallback
+	}
+	var rec struct {
+		Time time.Time `json:"time"`
+	}
+	if json.Unmarshal(line, &rec) != nil || rec.Time.IsZero() {
+		return fallback
+	}
+	return rec.Time
+}
+
+// rotate shifts path.N -> path.N+1, dropping anything past MaxBackups,
+// then moves the live file to path.1 and starts a fresh one.
+func (s *fileSink) rotate() error {
+	s.f.Close()
+	s.f = nil
+	if s.cfg.MaxBackups <= 0 {
+		os.Remove(s.cfg.Path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", s.cfg.Path, s.cfg.MaxBackups))
+		for i := s.cfg.MaxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.cfg.Path, i), fmt.Sprintf("%s.%d", s.cfg.Path, i+1))
+		}
+		os.Rename(s.cfg.Path, s.cfg.Path+".1")
+	}
+	return s.open()
+}
+
+// expireBackups deletes rotated files past the retention period. Backups
+// are numbered oldest-last, so everything after the first expired one goes.
+func (s *fileSink) expireBackups() {
+	if s.cfg.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.cfg.Retention)
+	expired := false
+	for i := 1; i <= s.cfg.MaxBackups; i++ {
+		name := fmt.Sprintf("%s.%d", s.cfg.Path, i)
+		if !expired {
+			info, err := os.Stat(name)
+			if err != nil {
+				return
+			}
+			expired = info.ModTime().Before(cutoff)
+		}
+		if expired {
+			os.Remove(name)
+		}
+	}
+}
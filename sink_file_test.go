@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockPath puts a non-empty directory where the sink's file should be, so
+// opening (and removing) it fails.
+func blockPath(t *testing.T, path string) {
+	t.Helper()
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "x"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func unblockPath(t *testing.T, path string) {
+	t.Helper()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(b), "\n")
+}
+
+func TestFileSinkReopenFailureKeepsHandle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+	s, err := newFileSink(FileOutputConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := Sample{Name: "m", Value: 1, Time: testStart}
+
+	// logrotate moved the file, but the new one can't be created.
+	moved := filepath.Join(dir, "out.json.1")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	blockPath(t, path)
+	if err := s.Reopen(); err == nil {
+		t.Fatal("Reopen succeeded over a directory")
+	}
+	if err := s.Send(sample); err != nil {
+		t.Fatalf("Send after failed Reopen: %v", err)
+	}
+	if n := countLines(t, moved); n != 1 {
+		t.Fatalf("%d lines in the moved file, want 1", n)
+	}
+
+	unblockPath(t, path)
+	if err := s.Reopen(); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	if err := s.Send(sample); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Fatalf("%d lines in the reopened file, want 1", n)
+	}
+}
+
+func TestFileSinkRetriesOpenAfterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	s, err := newFileSink(FileOutputConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := Sample{Name: "m", Value: 1, Time: testStart}
+
+	s.mu.Lock()
+	os.Remove(path)
+	blockPath(t, path)
+	err = s.rotate()
+	s.mu.Unlock()
+	if err == nil {
+		t.Fatal("rotate succeeded over a directory")
+	}
+	if err := s.Send(sample); err == nil {
+		t.Fatal("Send succeeded with nowhere to write")
+	}
+
+	unblockPath(t, path)
+	if err := s.Send(sample); err != nil {
+		t.Fatalf("Send once the path is free: %v", err)
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Fatalf("%d lines, want 1", n)
+	}
+}
+
+func TestFileSinkExpiresBackupsWithoutRotating(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	old := time.Now().Add(-48 * time.Hour)
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", path, i) }
+	makeBackups := func() {
+		for i := 1; i <= 2; i++ {
+			if err := os.WriteFile(backup(i), []byte("{}\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Only the older one is past retention.
+		if err := os.Chtimes(backup(2), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := func(when string) {
+		t.Helper()
+		if _, err := os.Stat(backup(1)); err != nil {
+			t.Fatalf("%s: fresh backup removed: %v", when, err)
+		}
+		if _, err := os.Stat(backup(2)); !os.IsNotExist(err) {
+			t.Fatalf("%s: expired backup still there (%v)", when, err)
+		}
+	}
+
+	makeBackups()
+	s, err := newFileSink(FileOutputConfig{Path: path, MaxBackups: 5, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired("startup")
+
+	makeBackups()
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	expired("reopen")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Graphite Sink ---
+
+type GraphiteConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Address  string `yaml:"address"`  // carbon host:port, usually :2003
+	Protocol string `yaml:"protocol"` // tcp (default) or udp
+	Prefix   string `yaml:"prefix"`   // Default "stat_monitor.{host}"
+}
+
+// graphiteSink sends "<prefix>.<name> <value> <unix time>" lines using the
+// carbon plaintext protocol.
+type graphiteSink struct {
+	prefix string
+	conn   *netConn
+}
+
+func newGraphiteSink(cfg GraphiteConfig) (*graphiteSink, error) {
+	conn, err := newNetConn(cfg.Protocol, cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "stat_monitor.{host}"
+	}
+	return &graphiteSink{prefix: cfg.Prefix, conn: conn}, nil
+}
+
+func (g *graphiteSink) Name() string { return "graphite" }
+
+func (g *graphiteSink) Send(s Sample) error {
+	// Events carry no new value; Graphite has nowhere to put the text.
+	if s.Event != "" {
+		return nil
+	}
+	// An FQDN host would otherwise become several hierarchy levels.
+	host := graphiteNode(hostName())
+	prefix := strings.Trim(graphitePath(strings.ReplaceAll(g.prefix, "{host}", host)), ".")
+	var b strings.Builder
+	if s.Values != nil {
+		for _, name := range sortedKeys(s.Values) {
+			fmt.Fprintf(&b, "%s.summary.%s %g %d\n", prefix, graphiteNode(name), s.Values[name], s.Time.Unix())
+		}
+	} else {
+		fmt.Fprintf(&b, "%s.%s %g %d\n", prefix, graphiteNode(s.Name), s.Value, s.Time.Unix())
+	}
+	return g.conn.writeLines([]byte(b.String()))
+}
+
+// graphitePath replaces characters that would break a carbon line. Dots
+// are kept: in a prefix they are intended hierarchy levels.
+func graphitePath(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// graphiteNode is graphitePath for a single level, where dots are replaced too.
+func graphiteNode(name string) string {
+	return strings.ReplaceAll(graphitePath(name), ".", "_")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// --- Incident Sinks (PagerDuty, Opsgenie) ---
+//
+// Open an incident when a metric breaches its threshold (see alert.go) and
+// resolve it when the metric recovers. Incidents are keyed by host and
+// metric name, so a repeat breach updates the open incident rather than
+// paging again, and the recovery closes exactly that one. Open incidents
+// are kept in global.state_file, so one still open at shutdown is resolved
+// by the first ok value after a restart.
+
+type IncidentConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Key         string        `yaml:"key"`          // PagerDuty integration (routing) key, or Opsgenie API key
+	URL         string        `yaml:"url"`          // API base override, e.g. https://api.eu.opsgenie.com
+	MinSeverity string        `yaml:"min_severity"` // Lowest severity that opens an incident: warn or crit (default)
+	Summary     string        `yaml:"summary"`      // Template, see alertData
+	Timeout     time.Duration `yaml:"timeout"`      // Per request, default 10s
+}
+
+const defaultIncidentSummary = `{{.Host}}: ` + defaultAlertMessage
+
+type incidentSink struct {
+	name    string // pagerduty or opsgenie
+	cfg     IncidentConfig
+	summary *template.Template
+	client  *http.Client
+	alerts  *alertTracker
+
+	mu   sync.Mutex
+	open map[string]string // Severity of each metric with an incident we opened
+}
+
+func newIncidentSink(name string, cfg IncidentConfig) (*incidentSink, error) {
+	if cfg.URL == "" {
+		cfg.URL = map[string]string{
+			"pagerduty": "https://events.pagerduty.com",
+			"opsgenie":  "https://api.opsgenie.com",
+		}[name]
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	switch cfg.MinSeverity {
+	case "":
+		cfg.MinSeverity = "crit"
+	case "warn", "crit":
+	default:
+		return nil, fmt.Errorf("unknown min_severity %q (warn or crit)", cfg.MinSeverity)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	summary, err := parseAlertTemplate("summary", cfg.Summary, defaultIncidentSummary)
+	if err != nil {
+		return nil, err
+	}
+	i := &incidentSink{
+		name:    name,
+		cfg:     cfg,
+		summary: summary,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		alerts:  newAlertTracker(),
+		open:    map[string]string{},
+	}
+	// The tracker starts from the saved severities, so recovering to ok
+	// counts as a change and resolves.
+	persisted.get(i.stateKey(), &i.open)
+	for metric, sev := range i.open {
+		i.alerts.severity[metric] = sev
+	}
+	return i, nil
+}
+
+// stateKey is where the open incidents are kept in the state file.
+func (i *incidentSink) stateKey() string {
+	return "_open_incidents_" + i.name
+}
+
+func (i *incidentSink) Name() string { return i.name }
+
+func (*incidentSink) alerting() {}
+
+func (i *incidentSink) Send(s Sample) error {
+	prev, ok := i.alerts.check(s)
+	if !ok {
+		return nil
+	}
+	i.mu.Lock()
+	_, open := i.open[s.Name]
+	i.mu.Unlock()
+
+	var err error
+	switch {
+	case s.Severity == "ok":
+		// Only close what we opened; recoveries from a level that never
+		// paged have nothing to resolve.
+		if open {
+			err = i.resolve(s)
+		}
+	case s.Severity == "crit" || i.cfg.MinSeverity == "warn":
+		var summary string
+		if summary, err = renderAlert(i.summary, newAlertData(s, prev)); err != nil {
+			return fmt.Errorf("summary: %w", err)
+		}
+		err = i.trigger(s, summary)
+	}
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	switch {
+	case s.Severity == "ok":
+		delete(i.open, s.Name)
+	case s.Severity == "crit" || i.cfg.MinSeverity == "warn":
+		i.open[s.Name] = s.Severity
+	}
+	persisted.put(i.stateKey(), i.open)
+	i.mu.Unlock()
+	i.alerts.record(s)
+	return nil
+}
+
+// incidentKey identifies a metric's incident across triggers and resolves.
+func incidentKey(metric string) string {
+	return hostName() + ":" + metric
+}
+
+func (i *incidentSink) trigger(s Sample, summary string) error {
+	details := map[string]any{
+		"value":     s.Value,
+		"unit":      s.Unit,
+		"threshold": s.Threshold,
+		"severity":  s.Severity,
+	}
+	for k, v := range s.Tags {
+		details[k] = v
+	}
+
+	if i.name == "pagerduty" {
+		severity := "warning"
+		if s.Severity == "crit" {
+			severity = "critical"
+		}
+		return i.post(i.cfg.URL+"/v2/enqueue", nil, map[string]any{
+			"routing_key":  i.cfg.Key,
+			"event_action": "trigger",
+			"dedup_key":    incidentKey(s.Name),
+			"payload": map[string]any{
+				"summary":        truncate(summary, 1024),
+				"source":         hostName(),
+				"severity":       severity,
+				"timestamp":      s.Time.UTC().Format(time.RFC3339),
+				"component":      s.Name,
+				"custom_details": details,
+			},
+		})
+	}
+
+	priority := "P3"
+	if s.Severity == "crit" {
+		priority = "P2"
+	}
+	return i.post(i.cfg.URL+"/v2/alerts", i.opsgenieAuth(), map[string]any{
+		"message":     truncate(summary, 130),
+		"alias":       incidentKey(s.Name),
+		"description": summary,
+		"priority":    priority,
+		"source":      "stat-monitor",
+		"entity":      hostName(),
+		"details":     details,
+	})
+}
+
+func (i *incidentSink) resolve(s Sample) error {
+	if i.name == "pagerduty" {
+		return i.post(i.cfg.URL+"/v2/enqueue", nil, map[string]any{
+			"routing_key":  i.cfg.Key,
+			"event_action": "resolve",
+			"dedup_key":    incidentKey(s.Name),
+		})
+	}
+	err := i.post(i.cfg.URL+"/v2/alerts/"+url.PathEscape(incidentKey(s.Name))+"/close?identifierType=alias",
+		i.opsgenieAuth(), map[string]any{"source": "stat-monitor", "note": s.Text()})
+	// Already closed by hand: nothing left to do.
+	if err != nil && strings.Contains(err.Error(), "404 Not Found") {
+		return nil
+	}
+	return err
+}
+
+func (i *incidentSink) opsgenieAuth() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + i.cfg.Key}
+}
+
+func (i *incidentSink) post(endpoint string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return httpSend(i.client, http.MethodPost, endpoint, "application/json", headers, body)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && n < len(s) && s[n]&0xc0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
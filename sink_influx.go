@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- InfluxDB v2 Sink ---
+
+type InfluxConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	URL    string `yaml:"url"` // e.g. "http://influx.lan:8086"
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	Token  string `yaml:"token"`
+}
+
+// influxSink writes each broadcast as one point through /api/v2/write:
+// the metric name is the measurement, host and the metric's labels
+// (path, interface, ...) are tags, and the value is the "value" field.
+type influxSink struct {
+	writeURL string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func newInfluxSink(cfg InfluxConfig) (*influxSink, error) {
+	if cfg.Org == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("org and bucket are required")
+	}
+	u, err := url.Parse(strings.TrimRight(cfg.URL, "/") + "/api/v2/write")
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{"org": {cfg.Org}, "bucket": {cfg.Bucket}, "precision": {"ns"}}.Encode()
+	return &influxSink{
+		writeURL: u.String(),
+		headers:  map[string]string{"Authorization": "Token " + cfg.Token},
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *influxSink) Name() string { return "influxdb" }
+
+func (s *influxSink) Send(sample Sample) error {
+	return httpSend(s.client, http.MethodPost, s.writeURL, "text/plain; charset=utf-8", s.headers, []byte(influxLine(sample)))
+}
+
+// influxLine renders a sample in line protocol. Summaries carry one field
+// per metric; events add string fields so they can be queried apart.
+func influxLine(s Sample) string {
+	var b strings.Builder
+	b.WriteString(influxEscape(s.Name, ", "))
+
+	tags := map[string]string{"host": hostName()}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	for _, k := range sortedKeys(tags) {
+		fmt.Fprintf(&b, ",%s=%s", influxEscape(k, ",= "), influxEscape(tags[k], ",= "))
+	}
+
+	var fields []string
+	if s.Values != nil {
+		for _, name := range sortedKeys(s.Values) {
+			fields = append(fields, influxEscape(name, ",= ")+"="+strconv.FormatFloat(s.Values[name], 'g', -1, 64))
+		}
+	} else {
+		fields = append(fields, "value="+strconv.FormatFloat(s.Value, 'g', -1, 64))
+	}
+	if s.Severity != "" {
+		fields = append(fields, "severity="+influxString(s.Severity))
+	}
+	if s.Event != "" {
+		fields = append(fields, "event="+influxString(s.Event))
+	}
+	if s.Error != "" {
+		fields = append(fields, "error="+influxString(s.Error))
+	}
+	fmt.Fprintf(&b, " %s %d\n", strings.Join(fields, ","), s.Time.UnixNano())
+	return b.String()
+}
+
+// influxEscape backslash-escapes the given special characters.
+func influxEscape(v, special string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if strings.ContainsRune(special, r) || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func influxString(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// --- Kafka Sink ---
+//
+// A minimal Kafka producer: Metadata to find partition leaders, then one
+// Produce request (record batch v2) per broadcast, optionally over TLS and
+// with SASL/PLAIN. Keys are hashed with murmur2 like the Java client, so a
+// metric always lands on the same partition as other producers would put it.
+
+type KafkaConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Brokers  []string `yaml:"brokers"`   // Bootstrap host:port list
+	Topic    string   `yaml:"topic"`     // Default "stat-monitor"
+	Key      string   `yaml:"key"`       // Default "{host}/{metric}"
+	Acks     string   `yaml:"acks"`      // leader (default) or all
+	ClientID string   `yaml:"client_id"` // Default "stat-monitor"
+	TLS      bool     `yaml:"tls"`
+	Username string   `yaml:"username"` // SASL/PLAIN when set
+	Password string   `yaml:"password"`
+}
+
+const kafkaTimeout = 10 * time.Second
+
+// Kafka API keys and the versions spoken here (the oldest Kafka 4 accepts).
+const (
+	kafkaProduce          = 0  // v3
+	kafkaMetadata         = 3  // v1
+	kafkaSaslHandshake    = 17 // v1
+	kafkaSaslAuthenticate = 36 // v0
+)
+
+type kafkaSink struct {
+	cfg  KafkaConfig
+	acks int16
+
+	mu      sync.Mutex
+	addrs   map[int32]string // Broker node ID -> host:port
+	leaders []int32          // Partition -> leader node ID; nil until metadata is fetched
+	conns   map[int32]*kafkaConn
+}
+
+func newKafkaSink(cfg KafkaConfig) (*kafkaSink, error) {
+	k := &kafkaSink{cfg: cfg, acks: 1}
+	switch cfg.Acks {
+	case "", "leader":
+	case "all":
+		k.acks = -1
+	default:
+		return nil, fmt.Errorf("unknown acks %q (leader or all)", cfg.Acks)
+	}
+	for _, b := range cfg.Brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			return nil, err
+		}
+	}
+	if k.cfg.Topic == "" {
+		k.cfg.Topic = "stat-monitor"
+	}
+	if k.cfg.Key == "" {
+		k.cfg.Key = "{host}/{metric}"
+	}
+	if k.cfg.ClientID == "" {
+		k.cfg.ClientID = "stat-monitor"
+	}
+	return k, nil
+}
+
+func (k *kafkaSink) Name() string { return "kafka" }
+
+func (k *kafkaSink) Send(s Sample) error {
+	value, err := json.Marshal(newSampleRecord(s))
+	if err != nil {
+		return err
+	}
+	key := []byte(expandName(k.cfg.Key, s.Name))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.produce(key, value, s.Time); err != nil {
+		// Leaders move; start over from the bootstrap brokers next time.
+		k.reset()
+		return err
+	}
+	return nil
+}
+
+func (k *kafkaSink) produce(key, value []byte, at time.Time) error {
+	if k.leaders == nil {
+		if err := k.refreshMetadata(); err != nil {
+			return err
+		}
+	}
+	partition := int32(murmur2(key)&0x7fffffff) % int32(len(k.leaders))
+	leader := k.leaders[partition]
+	conn, err := k.conn(leader)
+	if err != nil {
+		return err
+	}
+
+	records := kafkaRecordBatch(key, value, at)
+	var b []byte
+	b = binary.BigEndian.AppendUint16(b, 0xffff) // null transactional_id
+	b = binary.BigEndian.AppendUint16(b, uint16(k.acks))
+	b = binary.BigEndian.AppendUint32(b, uint32(kafkaTimeout/time.Millisecond))
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = kafkaString(b, k.cfg.Topic)
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint32(b, uint32(partition))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(records)))
+	b = append(b, records...)
+
+	resp, err := conn.roundTrip(kafkaProduce, 3, b)
+	if err != nil {
+		return err
+	}
+	r := kafkaReader{b: resp}
+	for range r.int32() { // topics
+		r.string()
+		for range r.int32() { // partitions
+			r.int32()
+			if code := r.int16(); code != 0 && r.err == nil {
+				return fmt.Errorf("produce to %s/%d: error code %d", k.cfg.Topic, partition, code)
+			}
+			r.int64()
+			r.int64()
+		}
+	}
+	return r.err
+}
+
+// refreshMetadata asks the bootstrap brokers, in order, for the topic's
+// partition leaders and the broker addresses.
+func (k *kafkaSink) refreshMetadata() error {
+	var lastErr error
+	for _, addr := range k.cfg.Brokers {
+		conn, err := k.dial(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		b := binary.BigEndian.AppendUint32(nil, 1)
+		b = kafkaString(b, k.cfg.Topic)
+		resp, err := conn.roundTrip(kafkaMetadata, 1, b)
+		conn.close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return k.parseMetadata(resp)
+	}
+	return fmt.Errorf("no broker reachable: %w", lastErr)
+}
+
+func (k *kafkaSink) parseMetadata(resp []byte) error {
+	r := kafkaReader{b: resp}
+	addrs := map[int32]string{}
+	for range r.int32() {
+		id, host, port := r.int32(), r.string(), r.int32()
+		r.nullableString() // rack
+		addrs[id] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	r.int32() // controller
+	var leaders []int32
+	for range r.int32() {
+		code, name := r.int16(), r.string()
+		r.bool() // internal
+		n := r.int32()
+		if name != k.cfg.Topic {
+			return errors.New("metadata for unexpected topic " + name)
+		}
+		if code != 0 && r.err == nil {
+			return fmt.Errorf("topic %s: error code %d", name, code)
+		}
+		leaders = make([]int32, n)
+		for range n {
+			r.int16()
+			p, leader := r.int32(), r.int32()
+			r.skipInt32s() // replicas
+			r.skipInt32s() // isr
+			if p >= 0 && p < n {
+				leaders[p] = leader
+			}
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("topic %s has no partitions", k.cfg.Topic)
+	}
+	k.addrs, k.leaders = addrs, leaders
+	return nil
+}
+
+func (k *kafkaSink) conn(node int32) (*kafkaConn, error) {
+	if c := k.conns[node]; c != nil {
+		return c, nil
+	}
+	addr, ok := k.addrs[node]
+	if !ok {
+		return nil, fmt.Errorf("no address for broker %d", node)
+	}
+	c, err := k.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if k.conns == nil {
+		k.conns = map[int32]*kafkaConn{}
+	}
+	k.conns[node] = c
+	return c, nil
+}
+
+func (k *kafkaSink) dial(addr string) (*kafkaConn, error) {
+	d := &net.Dialer{Timeout: kafkaTimeout}
+	var conn net.Conn
+	var err error
+	if k.cfg.TLS {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, nil)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &kafkaConn{conn: conn, r: bufio.NewReader(conn), clientID: k.cfg.ClientID}
+	if k.cfg.Username != "" {
+		if err := c.saslPlain(k.cfg.Username, k.cfg.Password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (k *kafkaSink) reset() {
+	for _, c := range k.conns {
+		c.close()
+	}
+	k.conns, k.addrs, k.leaders = nil, nil, nil
+}
+
+// kafkaConn is one broker connection. Requests are strictly sequential.
+type kafkaConn struct {
+	conn          net.Conn
+	r             *bufio.Reader
+	clientID      string
+	correlationID int32
+}
+
+func (c *kafkaConn) roundTrip(apiKey, version int16, body []byte) ([]byte, error) {
+	c.correlationID++
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, 0) // size, filled in below
+	b = binary.BigEndian.AppendUint16(b, uint16(apiKey))
+	b = binary.BigEndian.AppendUint16(b, uint16(version))
+	b = binary.BigEndian.AppendUint32(b, uint32(c.correlationID))
+	b = kafkaString(b, c.clientID)
+	b = append(b, body...)
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+
+	c.conn.SetDeadline(time.Now().Add(kafkaTimeout))
+	if _, err := c.conn.Write(b); err != nil {
+		return nil, err
+	}
+	var head [8]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head[:4])
+	if size < 4 || size > 64<<20 {
+		return nil, fmt.Errorf("bad response size %d", size)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(head[4:])); id != c.correlationID {
+		return nil, fmt.Errorf("response for request %d, expected %d", id, c.correlationID)
+	}
+	return resp, nil
+}
+
+func (c *kafkaConn) saslPlain(user, pass string) error {
+	resp, err := c.roundTrip(kafkaSaslHandshake, 1, kafkaString(nil, "PLAIN"))
+	if err != nil {
+		return err
+	}
+	r := kafkaReader{b: resp}
+	if code := r.int16(); code != 0 {
+		return fmt.Errorf("SASL handshake: error code %d (PLAIN not enabled?)", code)
+	}
+
+	token := "\x00" + user + "\x00" + pass
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(token)))
+	resp, err = c.roundTrip(kafkaSaslAuthenticate, 0, append(b, token...))
+	if err != nil {
+		return err
+	}
+	r = kafkaReader{b: resp}
+	if code, msg := r.int16(), r.nullableString(); code != 0 {
+		return fmt.Errorf("SASL authentication failed: %s (error code %d)", msg, code)
+	}
+	return r.err
+}
+
+func (c *kafkaConn) close() { c.conn.Close() }
+
+// kafkaRecordBatch encodes a single record as a v2 record batch.
+func kafkaRecordBatch(key, value []byte, at time.Time) []byte {
+	var rec []byte
+	rec = append(rec, 0)              // attributes
+	rec = binary.AppendVarint(rec, 0) // timestamp delta
+	rec = binary.AppendVarint(rec, 0) // offset delta
+	rec = binary.AppendVarint(rec, int64(len(key)))
+	rec = append(rec, key...)
+	rec = binary.AppendVarint(rec, int64(len(value)))
+	rec = append(rec, value...)
+	rec = binary.AppendVarint(rec, 0) // headers
+
+	ms := uint64(at.UnixMilli())
+	var tail []byte                                        // Everything covered by the CRC
+	tail = binary.BigEndian.AppendUint16(tail, 0)          // attributes: no compression
+	tail = binary.BigEndian.AppendUint32(tail, 0)          // last offset delta
+	tail = binary.BigEndian.AppendUint64(tail, ms)         // first timestamp
+	tail = binary.BigEndian.AppendUint64(tail, ms)         // max timestamp
+	tail = binary.BigEndian.AppendUint64(tail, ^uint64(0)) // producer ID -1
+	tail = binary.BigEndian.AppendUint16(tail, 0xffff)     // producer epoch -1
+	tail = binary.BigEndian.AppendUint32(tail, 0xffffffff) // base sequence -1
+	tail = binary.BigEndian.AppendUint32(tail, 1)          // record count
+	tail = binary.AppendVarint(tail, int64(len(rec)))
+	tail = append(tail, rec...)
+
+	var b []byte
+	b = binary.BigEndian.AppendUint64(b, 0)                       // base offset
+	b = binary.BigEndian.AppendUint32(b, uint32(4+1+4+len(tail))) // batch length
+	b = binary.BigEndian.AppendUint32(b, 0xffffffff)              // partition leader epoch
+	b = append(b, 2)                                              // magic
+	b = binary.BigEndian.AppendUint32(b, crc32.Checksum(tail, crc32.MakeTable(crc32.Castagnoli)))
+	return append(b, tail...)
+}
+
+// murmur2 is the Java client's key hash (its default partitioner).
+func murmur2(data []byte) int32 {
+	const m, r = 0x5bd1e995, 24
+	n := len(data)
+	h := uint32(0x9747b28c) ^ uint32(n)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+func kafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaReader decodes a response body; after the first short read every
+// call returns zero values and err is set.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		if r.err == nil {
+			r.err = errors.New("truncated response")
+		}
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) bool() bool {
+	b := r.next(1)
+	return b != nil && b[0] != 0
+}
+
+func (r *kafkaReader) string() string {
+	return string(r.next(int(r.int16())))
+}
+
+func (r *kafkaReader) nullableString() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+func (r *kafkaReader) skipInt32s() {
+	r.next(4 * int(r.int32()))
+}
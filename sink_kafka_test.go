@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kafkaAt is 1700000000000 ms since the epoch, 0x18bcfe56800.
+var kafkaAt = time.UnixMilli(1700000000000)
+
+// Golden bytes below were assembled by hand from the Kafka protocol guide,
+// CRC32C included, not produced by the code under test.
+
+// One record batch (v2) holding key "k" and value "v".
+const kafkaBatchHex = "" +
+	"0000000000000000" + // base offset
+	"0000003a" + // batch length
+	"ffffffff" + // partition leader epoch
+	"02" + // magic
+	"e99b8dd8" + // CRC32C of everything below
+	"0000" + // attributes
+	"00000000" + // last offset delta
+	"0000018bcfe56800" + // first timestamp
+	"0000018bcfe56800" + // max timestamp
+	"ffffffffffffffff" + // producer ID
+	"ffff" + // producer epoch
+	"ffffffff" + // base sequence
+	"00000001" + // record count
+	"10" + // record length 8 (zigzag varint)
+	"00" + // attributes
+	"00" + // timestamp delta
+	"00" + // offset delta
+	"02" + "6b" + // key "k"
+	"02" + "76" + // value "v"
+	"00" // headers
+
+func kafkaHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	got := kafkaRecordBatch([]byte("k"), []byte("v"), kafkaAt)
+	if want := kafkaHex(t, kafkaBatchHex); !bytes.Equal(got, want) {
+		t.Fatalf("record batch\ngot  %x\nwant %x", got, want)
+	}
+}
+
+// kafkaBroker answers one request on a pipe: it checks the request bytes
+// against want, unless nil, and replies with body under the request's
+// correlation ID.
+func kafkaBroker(t *testing.T, want []byte, body []byte) *kafkaConn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	done := make(chan struct{})
+	t.Cleanup(func() { <-done })
+
+	go func() {
+		defer close(done)
+		defer server.Close()
+		var size [4]byte
+		if _, err := io.ReadFull(server, size[:]); err != nil {
+			t.Errorf("read size: %v", err)
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(server, req); err != nil {
+			t.Errorf("read request: %v", err)
+			return
+		}
+		if got := append(size[:], req...); want != nil && !bytes.Equal(got, want) {
+			t.Errorf("request\ngot  %x\nwant %x", got, want)
+		}
+		var resp []byte
+		resp = binary.BigEndian.AppendUint32(resp, uint32(4+len(body)))
+		resp = append(resp, req[4:8]...) // correlation ID
+		resp = append(resp, body...)
+		server.Write(resp)
+	}()
+	return &kafkaConn{conn: client, r: bufio.NewReader(client), clientID: "sm"}
+}
+
+func TestKafkaRoundTripFraming(t *testing.T) {
+	want := kafkaHex(t, ""+
+		"00000013"+ // size
+		"0003"+ // API key (Metadata)
+		"0001"+ // API version
+		"00000001"+ // correlation ID
+		"0002"+"736d"+ // client ID "sm"
+		"00000001"+"0001"+"74") // topics ["t"]
+	c := kafkaBroker(t, want, []byte{0xca, 0xfe})
+
+	resp, err := c.roundTrip(kafkaMetadata, 1, kafkaString(binary.BigEndian.AppendUint32(nil, 1), "t"))
+	if err != nil {
+		t.Fatalf("roundTrip: %v", err)
+	}
+	if !bytes.Equal(resp, []byte{0xca, 0xfe}) {
+		t.Fatalf("response %x, want cafe", resp)
+	}
+}
+
+func TestKafkaProduceRequest(t *testing.T) {
+	want := kafkaHex(t, ""+
+		"0000006d"+ // size
+		"0000"+ // API key (Produce)
+		"0003"+ // API version
+		"00000001"+ // correlation ID
+		"0002"+"736d"+ // client ID "sm"
+		"ffff"+ // null transactional ID
+		"0001"+ // acks
+		"00002710"+ // timeout 10000 ms
+		"00000001"+"0001"+"74"+ // one topic, "t"
+		"00000001"+"00000000"+ // one partition, 0
+		"00000046"+kafkaBatchHex) // records
+	resp := kafkaHex(t, ""+
+		"00000001"+"0001"+"74"+ // one topic, "t"
+		"00000001"+"00000000"+ // one partition, 0
+		"0000"+ // error code
+		"000000000000002a"+ // base offset
+		"ffffffffffffffff"+ // log append time
+		"00000000") // throttle time
+
+	k, err := newKafkaSink(KafkaConfig{Topic: "t", ClientID: "sm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.leaders = []int32{7}
+	k.conns = map[int32]*kafkaConn{7: kafkaBroker(t, want, resp)}
+	if err := k.produce([]byte("k"), []byte("v"), kafkaAt); err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+}
+
+func TestKafkaProduceError(t *testing.T) {
+	resp := kafkaHex(t, ""+
+		"00000001"+"0001"+"74"+
+		"00000001"+"00000000"+
+		"0006"+ // NOT_LEADER_OR_FOLLOWER
+		"ffffffffffffffff"+
+		"ffffffffffffffff"+
+		"00000000")
+	k, err := newKafkaSink(KafkaConfig{Topic: "t", ClientID: "sm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.leaders = []int32{7}
+	// The request bytes are covered above; only the reply matters here.
+	k.conns = map[int32]*kafkaConn{7: kafkaBroker(t, nil, resp)}
+	err = k.produce([]byte("k"), []byte("v"), kafkaAt)
+	if err == nil || !strings.Contains(err.Error(), "error code 6") {
+		t.Fatalf("err %v, want error code 6", err)
+	}
+}
+
+// Metadata v1 response: two brokers, topic "t" with two partitions.
+const kafkaMetadataHex = "" +
+	"00000002" + // brokers
+	"00000001" + "0002" + "6231" + "00002384" + "ffff" + // 1 b1:9092, no rack
+	"00000002" + "0002" + "6232" + "00002385" + "0001" + "72" + // 2 b2:9093, rack "r"
+	"00000001" + // controller
+	"00000001" + // topics
+	"0000" + "0001" + "74" + "00" + // no error, "t", not internal
+	"00000002" + // partitions, listed out of order
+	"0000" + "00000001" + "00000001" + // partition 1, leader 1
+	"00000001" + "00000001" + // replicas [1]
+	"00000001" + "00000001" + // isr [1]
+	"0000" + "00000000" + "00000002" + // partition 0, leader 2
+	"00000002" + "00000002" + "00000001" + // replicas [2 1]
+	"00000001" + "00000002" // isr [2]
+
+func TestKafkaParseMetadata(t *testing.T) {
+	k := &kafkaSink{cfg: KafkaConfig{Topic: "t"}}
+	if err := k.parseMetadata(kafkaHex(t, kafkaMetadataHex)); err != nil {
+		t.Fatalf("parseMetadata: %v", err)
+	}
+	if want := map[int32]string{1: "b1:9092", 2: "b2:9093"}; !reflect.DeepEqual(k.addrs, want) {
+		t.Errorf("addrs %v, want %v", k.addrs, want)
+	}
+	if want := []int32{2, 1}; !reflect.DeepEqual(k.leaders, want) {
+		t.Errorf("leaders %v, want %v", k.leaders, want)
+	}
+}
+
+func TestKafkaParseMetadataErrors(t *testing.T) {
+	full := kafkaHex(t, kafkaMetadataHex)
+	tests := []struct {
+		name string
+		resp []byte
+		want string
+	}{
+		{"truncated", full[:len(full)-2], "truncated"},
+		{"unknown topic", kafkaHex(t, "00000000"+"ffffffff"+"00000001"+
+			"0003"+"0001"+"74"+"00"+"00000000"), "error code 3"},
+		{"other topic", kafkaHex(t, "00000000"+"ffffffff"+"00000001"+
+			"0000"+"0001"+"78"+"00"+"00000000"), "unexpected topic x"},
+		{"no partitions", kafkaHex(t, "00000000"+"ffffffff"+"00000000"), "no partitions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &kafkaSink{cfg: KafkaConfig{Topic: "t"}}
+			err := k.parseMetadata(tt.resp)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err %v, want it to contain %q", err, tt.want)
+			}
+			if k.leaders != nil {
+				t.Fatalf("leaders set to %v on error", k.leaders)
+			}
+		})
+	}
+}
+
+// Vectors from the Java client's own murmur2 tests.
+func TestMurmur2(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, tt := range tests {
+		if got := murmur2([]byte(tt.in)); got != tt.want {
+			t.Errorf("murmur2(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- MQTT Sink ---
+//
+// A minimal MQTT 3.1.1 publisher: CONNECT, PUBLISH at QoS 0 or 1, nothing
+// else. The connection is opened lazily and re-established on the next send
+// after any failure; the retry queue takes care of resending.
+
+type MQTTConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Broker    string        `yaml:"broker"`    // host:port, or tls://host:port
+	ClientID  string        `yaml:"client_id"` // Default "stat-monitor-<hostname>"
+	Username  string        `yaml:"username"`
+	Password  string        `yaml:"password"`
+	Topic     string        `yaml:"topic"`      // Default "stat-monitor/{host}/{metric}"
+	QoS       int           `yaml:"qos"`        // 0 (default) or 1
+	Retain    bool          `yaml:"retain"`     // Broker keeps the last value for new subscribers
+	Payload   string        `yaml:"payload"`    // json (default) or value (the bare number)
+	KeepAlive time.Duration `yaml:"keep_alive"` // Default 60s
+
+	Discovery       bool   `yaml:"discovery"`        // Announce each metric as a Home Assistant sensor
+	DiscoveryPrefix string `yaml:"discovery_prefix"` // Default "homeassistant"
+}
+
+const mqttTimeout = 10 * time.Second
+
+type mqttSink struct {
+	cfg MQTTConfig
+
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+	lastUsed time.Time
+	packetID uint16
+	// Metrics whose discovery config went out on this connection. Reset on
+	// reconnect, so a broker that lost its retained messages gets them again.
+	announced map[string]bool
+}
+
+func newMQTTSink(cfg MQTTConfig) (*mqttSink, error) {
+	if cfg.QoS < 0 || cfg.QoS > 1 {
+		return nil, fmt.Errorf("qos %d not supported (0 or 1)", cfg.QoS)
+	}
+	switch cfg.Payload {
+	case "", "json", "value":
+	default:
+		return nil, fmt.Errorf("unknown payload %q (json or value)", cfg.Payload)
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = "stat-monitor/{host}/{metric}"
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "stat-monitor-" + hostName()
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = 60 * time.Second
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = "homeassistant"
+	}
+	return &mqttSink{cfg: cfg}, nil
+}
+
+func (m *mqttSink) Name() string { return "mqtt" }
+
+func (m *mqttSink) Send(s Sample) error {
+	var payload []byte
+	if m.cfg.Payload == "value" {
+		payload = strconv.AppendFloat(nil, s.Value, 'f', -1, 64)
+	} else {
+		var err error
+		if payload, err = json.Marshal(newSampleRecord(s)); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topic := expandName(m.cfg.Topic, s.Name)
+	if err := m.announce(s, topic); err != nil {
+		m.close()
+		return err
+	}
+	if err := m.publish(topic, payload, m.cfg.Retain); err != nil {
+		m.close()
+		return err
+	}
+	return nil
+}
+
+// announce publishes the Home Assistant discovery config for the sample's
+// metric the first time it is seen on a connection. Configs are retained
+// so Home Assistant picks them up whenever it (re)starts.
+func (m *mqttSink) announce(s Sample, stateTopic string) error {
+	if !m.cfg.Discovery || s.Values != nil {
+		return nil
+	}
+	if m.conn != nil && m.announced[s.Name] {
+		return nil
+	}
+	host := haObjectID(hostName())
+	object := haObjectID(s.Name)
+	config := map[string]any{
+		"name":           s.Name,
+		"unique_id":      "stat_monitor_" + host + "_" + object,
+		"object_id":      host + "_" + object,
+		"state_topic":    stateTopic,
+		"value_template": "{{ value_json.value }}",
+		"state_class":    "measurement",
+		"device": map[string]any{
+			"identifiers":  []string{"stat_monitor_" + host},
+			"name":         hostName(),
+			"manufacturer": "stat-monitor",
+		},
+	}
+	if m.cfg.Payload == "value" {
+		config["value_template"] = "{{ value }}"
+	}
+	if unit, class := haUnit(s.Unit); unit != "" {
+		config["unit_of_measurement"] = unit
+		if class != "" {
+			config["device_class"] = class
+		}
+	}
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	topic := fmt.Sprintf("%s/sensor/%s/%s/config", m.cfg.DiscoveryPrefix, host, object)
+	if err := m.publish(topic, payload, true); err != nil {
+		return err
+	}
+	m.announced[s.Name] = true
+	return nil
+}
+
+// haUnit maps our units to the ones Home Assistant expects, with the
+// matching device class where there is one.
+func haUnit(unit string) (string, string) {
+	switch unit {
+	case "%":
+		return "%", ""
+	case "bytes":
+		return "B", "data_size"
+	case "MB", "GB":
+		return unit, "data_size"
+	case "Mbps":
+		return "Mbit/s", "data_rate"
+	case "ms", "s", "min", "h", "d":
+		return unit, "duration"
+	case "epoch":
+		return "", "" // Seconds since 1970; HA's timestamp class wants a date string
+	}
+	return unit, ""
+}
+
+// haObjectID makes s usable in a discovery topic and entity ID.
+func haObjectID(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, s)
+}
+
+func (m *mqttSink) publish(topic string, payload []byte, retain bool) error {
+	// We don't send PINGREQs, so the broker drops us after 1.5x keep-alive
+	// of silence. Reconnect before that rather than write into a dead socket.
+	if m.conn != nil && time.Since(m.lastUsed) >= m.cfg.KeepAlive {
+		m.close()
+	}
+	if m.conn == nil {
+		if err := m.connect(); err != nil {
+			return err
+		}
+	}
+	m.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	m.lastUsed = time.Now()
+
+	flags := byte(m.cfg.QoS << 1)
+	if retain {
+		flags |= 1
+	}
+	body := mqttString(nil, topic)
+	if m.cfg.QoS > 0 {
+		m.packetID++
+		if m.packetID == 0 {
+			m.packetID = 1
+		}
+		body = binary.BigEndian.AppendUint16(body, m.packetID)
+	}
+	body = append(body, payload...)
+	if _, err := m.conn.Write(mqttPacket(0x30|flags, body)); err != nil {
+		return err
+	}
+	if m.cfg.QoS == 0 {
+		return nil
+	}
+
+	for {
+		typ, body, err := readMQTTPacket(m.r)
+		if err != nil {
+			return fmt.Errorf("waiting for PUBACK: %w", err)
+		}
+		if typ>>4 == 4 && len(body) >= 2 && binary.BigEndian.Uint16(body) == m.packetID {
+			return nil
+		}
+	}
+}
+
+func (m *mqttSink) connect() error {
+	addr, useTLS := strings.CutPrefix(m.cfg.Broker, "tls://")
+	addr = strings.TrimPrefix(addr, "mqtt://")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port := "1883"
+		if useTLS {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(addr, port)
+	}
+
+	d := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, nil)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+
+	flags := byte(0x02) // clean session
+	body := mqttString(nil, "MQTT")
+	if m.cfg.Username != "" {
+		flags |= 0x80
+	}
+	if m.cfg.Password != "" {
+		flags |= 0x40
+	}
+	body = append(body, 4, flags) // protocol level 4 = 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(m.cfg.KeepAlive/time.Second))
+	body = mqttString(body, m.cfg.ClientID)
+	if m.cfg.Username != "" {
+		body = mqttString(body, m.cfg.Username)
+	}
+	if m.cfg.Password != "" {
+		body = mqttString(body, m.cfg.Password)
+	}
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	typ, ack, err := readMQTTPacket(r)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("waiting for CONNACK: %w", err)
+	}
+	if typ>>4 != 2 || len(ack) < 2 {
+		conn.Close()
+		return errors.New("unexpected reply to CONNECT")
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused connection (return code %d)", ack[1])
+	}
+	m.conn, m.r = conn, r
+	m.announced = map[string]bool{}
+	return nil
+}
+
+func (m *mqttSink) close() {
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn, m.r = nil, nil
+	}
+}
+
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttPacket prepends the fixed header: type/flags and the remaining length.
+func mqttPacket(header byte, body []byte) []byte {
+	out := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		out = append(out, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// --- Nagios/Icinga Passive Check Sink ---
+//
+// Submits every broadcast as a passive service check result, with the
+// state taken from the thresholds (ok 0, warn 1, crit 2, collection error
+// 3 UNKNOWN). Results go to one of:
+//   - an NSCA daemon (send_nsca's protocol, unencrypted or XOR),
+//   - the external command file (the named pipe nagios.cmd), or
+//   - a livestatus socket, as COMMAND lines.
+
+type NagiosConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	NSCA          string        `yaml:"nsca"`           // host:port of the NSCA daemon; port defaults to 5667
+	Password      string        `yaml:"password"`       // NSCA password, for xor encryption
+	Encryption    string        `yaml:"encryption"`     // NSCA encryption: none (default) or xor
+	CommandFile   string        `yaml:"command_file"`   // Path of the external command pipe
+	Livestatus    string        `yaml:"livestatus"`     // Socket path, or host:port
+	Host          string        `yaml:"host"`           // Nagios host name, default the hostname
+	Service       string        `yaml:"service"`        // Service description pattern, default "{metric}"
+	FlushInterval time.Duration `yaml:"flush_interval"` // Batch window, default 1s
+}
+
+const (
+	nagiosTimeout    = 10 * time.Second
+	nagiosMaxResults = 100 // Per batch
+
+	// NSCA 2.x packet: version 3, with the 512-byte plugin output that
+	// every NSCA 2.7+ daemon accepts.
+	nscaIVSize     = 128
+	nscaHostLen    = 64
+	nscaServiceLen = 128
+	nscaOutputLen  = 512
+	nscaPacketSize = 720
+)
+
+type nagiosSink struct {
+	cfg NagiosConfig
+}
+
+// nagiosResult is one passive check result.
+type nagiosResult struct {
+	time          time.Time
+	host, service string
+	code          int
+	output        string
+}
+
+func newNagiosSink(cfg NagiosConfig) (*nagiosSink, error) {
+	n := 0
+	for _, dest := range []string{cfg.NSCA, cfg.CommandFile, cfg.Livestatus} {
+		if dest != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("set exactly one of nsca, command_file or livestatus")
+	}
+	if cfg.NSCA != "" {
+		if _, _, err := net.SplitHostPort(cfg.NSCA); err != nil {
+			cfg.NSCA = net.JoinHostPort(cfg.NSCA, "5667")
+		}
+		switch cfg.Encryption {
+		case "", "none", "xor":
+		default:
+			return nil, fmt.Errorf("unsupported encryption %q (none or xor)", cfg.Encryption)
+		}
+	}
+	if cfg.Host == "" {
+		cfg.Host = "{host}"
+	}
+	if cfg.Service == "" {
+		cfg.Service = "{metric}"
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	return &nagiosSink{cfg: cfg}, nil
+}
+
+func (n *nagiosSink) Name() string { return "nagios" }
+
+// alerting makes Nagios see a state change as it happens, not only with
+// the next broadcast.
+func (*nagiosSink) alerting() {}
+
+func (n *nagiosSink) Send(s Sample) error {
+	return n.SendBatch([]Sample{s})
+}
+
+func (n *nagiosSink) batchLimits() (int, time.Duration) {
+	return nagiosMaxResults, n.cfg.FlushInterval
+}
+
+func (n *nagiosSink) SendBatch(samples []Sample) error {
+	var results []nagiosResult
+	for _, s := range samples {
+		r := nagiosResult{
+			time:    s.Time,
+			host:    expandName(n.cfg.Host, s.Name),
+			service: expandName(n.cfg.Service, s.Name),
+		}
+		switch {
+		case s.Event == "error":
+			r.code = 3
+			r.output = nagiosStates[r.code] + " - " + s.Error
+		case s.Event != "" || s.Values != nil:
+			continue // The next value reports the state
+		default:
+			r.code = map[string]int{"ok": 0, "warn": 1, "crit": 2}[s.Severity]
+			// "|" starts the performance data, so it can't appear before.
+			text := strings.ReplaceAll(s.Text(), "|", "/")
+			r.output = nagiosStates[r.code] + " - " + text + " | " + nagiosPerfData(s)
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	switch {
+	case n.cfg.NSCA != "":
+		return n.sendNSCA(results)
+	case n.cfg.CommandFile != "":
+		return n.writeCommandFile(results)
+	default:
+		return n.sendLivestatus(results)
+	}
+}
+
+var nagiosStates = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosPerfData renders 'name'=value[UOM], using a unit Nagios knows.
+func nagiosPerfData(s Sample) string {
+	uom := map[string]string{"%": "%", "bytes": "B", "MB": "MB", "GB": "GB", "s": "s", "ms": "ms"}[s.Unit]
+	return "'" + strings.ReplaceAll(s.Name, "'", "''") + "'=" + strconv.FormatFloat(s.Value, 'f', -1, 64) + uom
+}
+
+// command is the external command for r, without the trailing newline.
+func (r nagiosResult) command() string {
+	clean := strings.NewReplacer("\n", " ", ";", ",").Replace
+	return fmt.Sprintf("[%d] PROCESS_SERVICE_CHECK_RESULT;%s;%s;%d;%s",
+		r.time.Unix(), clean(r.host), clean(r.service), r.code, strings.ReplaceAll(r.output, "\n", " "))
+}
+
+// writeCommandFile writes to the named pipe without blocking, so a stopped
+// Nagios (no reader) fails fast instead of hanging the queue.
+func (n *nagiosSink) writeCommandFile(results []nagiosResult) error {
+	f, err := os.OpenFile(n.cfg.CommandFile, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Writes up to PIPE_BUF are atomic, so one per result keeps lines from
+	// interleaving with other writers.
+	for _, r := range results {
+		if _, err := f.WriteString(r.command() + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *nagiosSink) sendLivestatus(results []nagiosResult) error {
+	network := "tcp"
+	if strings.HasPrefix(n.cfg.Livestatus, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, n.cfg.Livestatus, nagiosTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(nagiosTimeout))
+	var b strings.Builder
+	for _, r := range results {
+		b.WriteString("COMMAND " + r.command() + "\n\n")
+	}
+	_, err = io.WriteString(conn, b.String())
+	return err
+}
+
+func (n *nagiosSink) sendNSCA(results []nagiosResult) error {
+	conn, err := net.DialTimeout("tcp", n.cfg.NSCA, nagiosTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(nagiosTimeout))
+
+	// The daemon opens with an IV for encryption and its timestamp, which
+	// it expects back in each packet.
+	var init [nscaIVSize + 4]byte
+	if _, err := io.ReadFull(conn, init[:]); err != nil {
+		return fmt.Errorf("reading NSCA greeting: %w", err)
+	}
+	iv, timestamp := init[:nscaIVSize], binary.BigEndian.Uint32(init[nscaIVSize:])
+
+	var out []byte
+	for _, r := range results {
+		pkt := make([]byte, nscaPacketSize)
+		binary.BigEndian.PutUint16(pkt[0:], 3)
+		binary.BigEndian.PutUint32(pkt[8:], timestamp)
+		binary.BigEndian.PutUint16(pkt[12:], uint16(r.code))
+		copy(pkt[14:14+nscaHostLen-1], r.host)
+		copy(pkt[78:78+nscaServiceLen-1], r.service)
+		copy(pkt[206:206+nscaOutputLen-1], r.output)
+		binary.BigEndian.PutUint32(pkt[4:], crc32.ChecksumIEEE(pkt))
+
+		if n.cfg.Encryption == "xor" {
+			for i := range pkt {
+				pkt[i] ^= iv[i%nscaIVSize]
+				if n.cfg.Password != "" {
+					pkt[i] ^= n.cfg.Password[i%len(n.cfg.Password)]
+				}
+			}
+		}
+		out = append(out, pkt...)
+	}
+	// NSCA doesn't acknowledge; a bad password or CRC is only in its log.
+	_, err = conn.Write(out)
+	return err
+}
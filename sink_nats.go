@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- NATS Sink ---
+//
+// A minimal NATS client speaking the text protocol: CONNECT, then PUB
+// followed by a PING so the server's PONG (or -ERR) confirms each publish.
+// With JetStream the publish carries a reply inbox and waits for the
+// stream's ack instead.
+
+type NATSConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	URL       string `yaml:"url"`     // host:port, nats://host:port or tls://host:port
+	Subject   string `yaml:"subject"` // Default "stat-monitor.{host}.{metric}"
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	Token     string `yaml:"token"`
+	JetStream bool   `yaml:"jetstream"` // Wait for a stream to store each message
+}
+
+const (
+	natsTimeout = 10 * time.Second
+	// The server pings idle clients and drops those that don't answer; we only
+	// read while publishing, so reconnect rather than trust a quiet connection.
+	natsMaxIdle = time.Minute
+)
+
+type natsSink struct {
+	cfg NATSConfig
+
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+	inbox    string
+	lastUsed time.Time
+}
+
+func newNATSSink(cfg NATSConfig) (*natsSink, error) {
+	if cfg.Subject == "" {
+		cfg.Subject = "stat-monitor.{host}.{metric}"
+	}
+	return &natsSink{cfg: cfg}, nil
+}
+
+func (n *natsSink) Name() string { return "nats" }
+
+func (n *natsSink) Send(s Sample) error {
+	payload, err := json.Marshal(newSampleRecord(s))
+	if err != nil {
+		return err
+	}
+	// Dots separate subject tokens; a dotted hostname or metric would add levels.
+	subject := strings.NewReplacer("{host}", natsToken(hostName()), "{metric}", natsToken(s.Name)).Replace(n.cfg.Subject)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.publish(subject, payload); err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+
+func (n *natsSink) publish(subject string, payload []byte) error {
+	if n.conn != nil && time.Since(n.lastUsed) >= natsMaxIdle {
+		n.close()
+	}
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+	n.conn.SetDeadline(time.Now().Add(natsTimeout))
+	n.lastUsed = time.Now()
+
+	var b []byte
+	if n.cfg.JetStream {
+		b = fmt.Appendf(b, "PUB %s %s %d\r\n", subject, n.inbox, len(payload))
+	} else {
+		b = fmt.Appendf(b, "PUB %s %d\r\n", subject, len(payload))
+	}
+	b = append(b, payload...)
+	b = append(b, "\r\n"...)
+	if !n.cfg.JetStream {
+		b = append(b, "PING\r\n"...)
+	}
+	if _, err := n.conn.Write(b); err != nil {
+		return err
+	}
+
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(n.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case line == "PONG" && !n.cfg.JetStream:
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("server: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case strings.HasPrefix(line, "MSG "), strings.HasPrefix(line, "HMSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			// HMSG <subject> <sid> [reply-to] <#header bytes> <#total bytes>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			hdrSize := 0
+			if err == nil && fields[0] == "HMSG" {
+				hdrSize, err = strconv.Atoi(fields[len(fields)-2])
+			}
+			if err != nil || hdrSize > size {
+				return fmt.Errorf("malformed reply %q", line)
+			}
+			body := make([]byte, size+2)
+			if _, err := io.ReadFull(n.r, body); err != nil {
+				return err
+			}
+			// A header-only "NATS/1.0 503" reply means no stream has this subject.
+			if hdrSize > 0 && strings.HasPrefix(string(body[:hdrSize]), "NATS/1.0 503") {
+				return errors.New("no JetStream stream for subject")
+			}
+			return jetStreamAck(body[hdrSize:size])
+		}
+	}
+}
+
+// jetStreamAck checks a publish ack: {"stream":...,"seq":...} or {"error":...}.
+func jetStreamAck(body []byte) error {
+	var ack struct {
+		Stream string `json:"stream"`
+		Error  *struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &ack); err != nil {
+		return fmt.Errorf("bad JetStream ack: %w", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("JetStream: %s (%d)", ack.Error.Description, ack.Error.Code)
+	}
+	return nil
+}
+
+func (n *natsSink) connect() error {
+	addr, useTLS := strings.CutPrefix(n.cfg.URL, "tls://")
+	addr = strings.TrimPrefix(addr, "nats://")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "4222")
+	}
+	conn, err := net.DialTimeout("tcp", addr, natsTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	n.conn, n.r = conn, bufio.NewReader(conn)
+
+	line, err := n.readLine()
+	if err != nil {
+		n.close()
+		return fmt.Errorf("waiting for INFO: %w", err)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+		Headers     bool `json:"headers"`
+	}
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	if !ok || json.Unmarshal([]byte(infoJSON), &info) != nil {
+		n.close()
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	// NATS upgrades to TLS after the plaintext INFO.
+	if useTLS || info.TLSRequired {
+		host, _, _ := net.SplitHostPort(addr)
+		tc := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tc.Handshake(); err != nil {
+			n.close()
+			return err
+		}
+		n.conn, n.r = tc, bufio.NewReader(tc)
+	}
+
+	opts := map[string]any{
+		"verbose": false, "pedantic": false, "name": "stat-monitor", "lang": "go",
+		"version": "1", "protocol": 1, "no_responders": info.Headers, "headers": info.Headers,
+	}
+	if n.cfg.Username != "" {
+		opts["user"], opts["pass"] = n.cfg.Username, n.cfg.Password
+	}
+	if n.cfg.Token != "" {
+		opts["auth_token"] = n.cfg.Token
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		n.close()
+		return err
+	}
+	msg := "CONNECT " + string(connect) + "\r\n"
+	if n.cfg.JetStream {
+		var id [8]byte
+		rand.Read(id[:])
+		n.inbox = "_INBOX." + hex.EncodeToString(id[:])
+		msg += "SUB " + n.inbox + " 1\r\n"
+	}
+	// A PING/PONG round trip confirms the server accepted CONNECT.
+	if _, err := io.WriteString(n.conn, msg+"PING\r\n"); err != nil {
+		n.close()
+		return err
+	}
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			n.close()
+			return fmt.Errorf("waiting for PONG: %w", err)
+		}
+		if line == "PONG" {
+			return nil
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			n.close()
+			return errors.New("server: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *natsSink) readLine() (string, error) {
+	line, err := n.r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (n *natsSink) close() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.r = nil, nil
+	}
+}
+
+// natsToken makes s safe as a single subject token.
+func natsToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '\t', '*', '>':
+			return '_'
+		}
+		return r
+	}, s)
+}
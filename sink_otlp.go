@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --- OpenTelemetry (OTLP) Sink ---
+//
+// Exports each broadcast as a one-point gauge in an OTLP
+// ExportMetricsServiceRequest, over OTLP/HTTP (protobuf) or OTLP/gRPC. The
+// message is hand-encoded with the helpers in protobuf.go and the gRPC call
+// is a plain HTTP/2 POST, so no OpenTelemetry or gRPC library is needed.
+
+type OTLPConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Endpoint           string            `yaml:"endpoint"` // http(s)://collector:4318 for http, collector:4317 or https://... for grpc
+	Protocol           string            `yaml:"protocol"` // http (default) or grpc
+	Headers            map[string]string `yaml:"headers"`  // e.g. an API key for a hosted backend
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	Timeout            time.Duration     `yaml:"timeout"` // Per request, default 10s
+}
+
+const otlpExportPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+type otlpSink struct {
+	cfg      OTLPConfig
+	url      string
+	client   *http.Client
+	resource []byte // Encoded Resource, the same for every request
+}
+
+func newOTLPSink(cfg OTLPConfig) (*otlpSink, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	endpoint := cfg.Endpoint
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch cfg.Protocol {
+	case "", "http":
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/metrics"
+		}
+		endpoint = u.String()
+	case "grpc":
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		// gRPC needs HTTP/2; without TLS that means h2c with prior knowledge.
+		var protocols http.Protocols
+		if strings.HasPrefix(endpoint, "https://") {
+			protocols.SetHTTP2(true)
+		} else {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+		transport.Protocols = &protocols
+		endpoint = strings.TrimRight(endpoint, "/") + otlpExportPath
+	default:
+		return nil, fmt.Errorf("unknown protocol %q (http or grpc)", cfg.Protocol)
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]string{"service.name": "stat-monitor", "host.name": hostName()}
+	for k, v := range cfg.ResourceAttributes {
+		attrs[k] = v
+	}
+	return &otlpSink{
+		cfg:      cfg,
+		url:      endpoint,
+		client:   &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		resource: otlpAttributes(nil, 1, attrs),
+	}, nil
+}
+
+func (o *otlpSink) Name() string { return "otlp" }
+
+func (o *otlpSink) Send(s Sample) error {
+	// Events and summaries repeat values the collector already has.
+	if s.Event != "" || s.Values != nil {
+		return nil
+	}
+	body := o.marshal(s)
+	if o.cfg.Protocol == "grpc" {
+		return o.sendGRPC(body)
+	}
+	return httpSend(o.client, http.MethodPost, o.url, "application/x-protobuf", o.cfg.Headers, body)
+}
+
+// marshal encodes ExportMetricsServiceRequest{ResourceMetrics{Resource,
+// ScopeMetrics{Scope, Metric{Gauge{NumberDataPoint}}}}}.
+func (o *otlpSink) marshal(s Sample) []byte {
+	var point []byte
+	point = appendFixed64(point, 3, uint64(s.Time.UnixNano())) // time_unix_nano
+	point = appendFixed64(point, 4, math.Float64bits(s.Value)) // as_double, even when 0
+	point = otlpAttributes(point, 7, s.Tags)
+
+	var metric []byte
+	metric = appendString(metric, 1, s.Name)
+	metric = appendString(metric, 3, s.Unit)
+	metric = appendMessage(metric, 5, appendMessage(nil, 1, point)) // gauge.data_points
+
+	var scope []byte
+	scope = appendMessage(scope, 1, appendString(nil, 1, "stat-monitor"))
+	scope = appendMessage(scope, 2, metric)
+
+	var rm []byte
+	rm = appendMessage(rm, 1, o.resource)
+	rm = appendMessage(rm, 2, scope)
+	return appendMessage(nil, 1, rm)
+}
+
+func (o *otlpSink) sendGRPC(msg []byte) error {
+	var body bytes.Buffer
+	writeGRPCMessage(&body, msg)
+	req, err := http.NewRequest(http.MethodPost, o.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("User-Agent", "stat-monitor")
+	for k, v := range o.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Trailers arrive after the body
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s", o.url, resp.Status)
+	}
+	// A call that fails outright is "Trailers-Only": the status is in the headers.
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		return fmt.Errorf("export failed: grpc-status %s: %s", status, message)
+	}
+	return nil
+}
+
+// otlpAttributes appends each attribute as a KeyValue{key, AnyValue{string_value}}.
+func otlpAttributes(b []byte, field int, attrs map[string]string) []byte {
+	for _, k := range sortedKeys(attrs) {
+		var kv []byte
+		kv = appendString(kv, 1, k)
+		kv = appendMessage(kv, 2, appendString(nil, 1, attrs[k]))
+		b = appendMessage(b, field, kv)
+	}
+	return b
+}
+
+// appendFixed64 always writes the field: OTLP's oneof and timestamp fields
+// must be present even when zero.
+func appendFixed64(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// --- Push Notification Sinks (ntfy, Gotify) ---
+//
+// Phone notifications for threshold alerts (see alert.go). Both services
+// take a small JSON message with a title and priority; ntfy routes by
+// topic, Gotify by application token. Each metric can override where its
+// alerts go, their priority and their text.
+
+type PushConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	URL      string               `yaml:"url"`      // ntfy default https://ntfy.sh; the Gotify server
+	Topic    string               `yaml:"topic"`    // ntfy topic; {host} and {metric} are expanded
+	Token    string               `yaml:"token"`    // ntfy access token, or the Gotify application token
+	Priority string               `yaml:"priority"` // min, low, default, high, urgent or 1-5; default by severity
+	Title    string               `yaml:"title"`    // Template, see alertData
+	Message  string               `yaml:"message"`  // Template, see alertData
+	Metrics  map[string]PushRoute `yaml:"metrics"`  // Per-metric overrides, keyed by metric name
+	Timeout  time.Duration        `yaml:"timeout"`  // Per request, default 10s
+}
+
+// PushRoute overrides the output's settings for one metric.
+type PushRoute struct {
+	Topic    string `yaml:"topic"`
+	Token    string `yaml:"token"`
+	Priority string `yaml:"priority"`
+	Title    string `yaml:"title"`
+	Message  string `yaml:"message"`
+}
+
+// pushRoute is a PushRoute with the defaults filled in and templates parsed.
+type pushRoute struct {
+	topic, token   string
+	priority       int // 1-5, 0 for "by severity"
+	title, message *template.Template
+}
+
+type pushSink struct {
+	name    string // ntfy or gotify
+	url     string
+	def     pushRoute
+	metrics map[string]pushRoute
+	client  *http.Client
+	alerts  *alertTracker
+}
+
+func newNtfySink(cfg PushConfig) (*pushSink, error) {
+	if cfg.URL == "" {
+		cfg.URL = "https://ntfy.sh"
+	}
+	return newPushSink("ntfy", cfg)
+}
+
+func newGotifySink(cfg PushConfig) (*pushSink, error) {
+	return newPushSink("gotify", cfg)
+}
+
+func newPushSink(name string, cfg PushConfig) (*pushSink, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	p := &pushSink{
+		name:    name,
+		url:     strings.TrimSuffix(cfg.URL, "/"),
+		metrics: map[string]pushRoute{},
+		client:  &http.Client{Timeout: cfg.Timeout},
+		alerts:  newAlertTracker(),
+	}
+	var err error
+	if p.def, err = newPushRoute(pushRoute{}, PushRoute{cfg.Topic, cfg.Token, cfg.Priority, cfg.Title, cfg.Message}); err != nil {
+		return nil, err
+	}
+	for metric, r := range cfg.Metrics {
+		if p.metrics[metric], err = newPushRoute(p.def, r); err != nil {
+			return nil, fmt.Errorf("metrics.%s: %w", metric, err)
+		}
+	}
+	// Without a default destination only the listed metrics alert.
+	missing := "topic"
+	if name == "gotify" {
+		missing = "token"
+	}
+	for metric, r := range p.metrics {
+		if !p.complete(r) {
+			return nil, fmt.Errorf("metrics.%s: no %s", metric, missing)
+		}
+	}
+	if !p.complete(p.def) && len(p.metrics) == 0 {
+		return nil, fmt.Errorf("%s is required", missing)
+	}
+	return p, nil
+}
+
+// complete reports whether r says where to send: a topic for ntfy, an
+// application token for Gotify.
+func (p *pushSink) complete(r pushRoute) bool {
+	if p.name == "ntfy" {
+		return r.topic != ""
+	}
+	return r.token != ""
+}
+
+// newPushRoute applies r on top of base.
+func newPushRoute(base pushRoute, r PushRoute) (pushRoute, error) {
+	out := base
+	if r.Topic != "" {
+		out.topic = r.Topic
+	}
+	if r.Token != "" {
+		out.token = r.Token
+	}
+	if r.Priority != "" {
+		p, err := parsePushPriority(r.Priority)
+		if err != nil {
+			return out, err
+		}
+		out.priority = p
+	}
+	var err error
+	if r.Title != "" || out.title == nil {
+		if out.title, err = parseAlertTemplate("title", r.Title, defaultAlertTitle); err != nil {
+			return out, err
+		}
+	}
+	if r.Message != "" || out.message == nil {
+		if out.message, err = parseAlertTemplate("message", r.Message, defaultAlertMessage); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// parsePushPriority accepts ntfy's priority names or numbers 1-5.
+func parsePushPriority(s string) (int, error) {
+	for i, name := range []string{"min", "low", "default", "high", "urgent"} {
+		if strings.EqualFold(s, name) || s == strconv.Itoa(i+1) {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q (min, low, default, high, urgent or 1-5)", s)
+}
+
+func (p *pushSink) Name() string { return p.name }
+
+func (*pushSink) alerting() {}
+
+func (p *pushSink) Send(s Sample) error {
+	prev, ok := p.alerts.check(s)
+	if !ok {
+		return nil
+	}
+	r, ok := p.metrics[s.Name]
+	if !ok {
+		if !p.complete(p.def) {
+			return nil
+		}
+		r = p.def
+	}
+	d := newAlertData(s, prev)
+	title, err := renderAlert(r.title, d)
+	if err != nil {
+		return fmt.Errorf("title: %w", err)
+	}
+	message, err := renderAlert(r.message, d)
+	if err != nil {
+		return fmt.Errorf("message: %w", err)
+	}
+
+	// Recoveries are informational; breaches use the configured priority,
+	// or one by severity.
+	priority := r.priority
+	switch {
+	case s.Severity == "ok":
+		priority = 2
+	case priority == 0 && s.Severity == "crit":
+		priority = 4
+	case priority == 0:
+		priority = 3
+	}
+
+	if p.name == "ntfy" {
+		err = p.sendNtfy(r, s, title, message, priority)
+	} else {
+		err = p.sendGotify(r, title, message, priority)
+	}
+	if err != nil {
+		return err
+	}
+	p.alerts.record(s)
+	return nil
+}
+
+// sendNtfy publishes as JSON to the server root, which keeps non-ASCII
+// titles intact (headers can't carry them).
+func (p *pushSink) sendNtfy(r pushRoute, s Sample, title, message string, priority int) error {
+	tag := map[string]string{"crit": "rotating_light", "warn": "warning", "ok": "white_check_mark"}[s.Severity]
+	body, err := json.Marshal(map[string]any{
+		"topic":    expandName(r.topic, s.Name),
+		"title":    title,
+		"message":  message,
+		"priority": priority,
+		"tags":     []string{tag},
+	})
+	if err != nil {
+		return err
+	}
+	var headers map[string]string
+	if r.token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + r.token}
+	}
+	return httpSend(p.client, http.MethodPost, p.url, "application/json", headers, body)
+}
+
+// gotifyPriority maps 1-5 onto Gotify's 0-10, where 8 and up is high
+// priority on Android and 0 is silent.
+var gotifyPriority = [...]int{0, 0, 2, 5, 8, 10}
+
+func (p *pushSink) sendGotify(r pushRoute, title, message string, priority int) error {
+	body, err := json.Marshal(map[string]any{
+		"title":    title,
+		"message":  message,
+		"priority": gotifyPriority[priority],
+	})
+	if err != nil {
+		return err
+	}
+	return httpSend(p.client, http.MethodPost, p.url+"/message", "application/json",
+		map[string]string{"X-Gotify-Key": r.token}, body)
+}
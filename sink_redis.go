@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Redis Sink ---
+//
+// Speaks RESP directly: PUBLISH to a channel, or XADD to a stream, one
+// command per broadcast with the reply checked for errors.
+
+type RedisConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Address  string `yaml:"address"`  // host:port, or tls://host:port
+	Mode     string `yaml:"mode"`     // publish (default) or stream
+	Key      string `yaml:"key"`      // Channel or stream key; default "stat-monitor:{host}:{metric}"
+	MaxLen   int    `yaml:"max_len"`  // Stream mode: trim to roughly this many entries; 0 keeps all
+	Username string `yaml:"username"` // ACL user (Redis 6+); omit for plain requirepass
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+const redisTimeout = 10 * time.Second
+
+type redisSink struct {
+	cfg RedisConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRedisSink(cfg RedisConfig) (*redisSink, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = "publish"
+	case "publish", "stream":
+	default:
+		return nil, fmt.Errorf("unknown mode %q (publish or stream)", cfg.Mode)
+	}
+	if cfg.Key == "" {
+		cfg.Key = "stat-monitor:{host}:{metric}"
+	}
+	return &redisSink{cfg: cfg}, nil
+}
+
+func (r *redisSink) Name() string { return "redis" }
+
+func (r *redisSink) Send(s Sample) error {
+	data, err := json.Marshal(newSampleRecord(s))
+	if err != nil {
+		return err
+	}
+	key := expandName(r.cfg.Key, s.Name)
+	var cmd []string
+	if r.cfg.Mode == "stream" {
+		cmd = []string{"XADD", key}
+		if r.cfg.MaxLen > 0 {
+			cmd = append(cmd, "MAXLEN", "~", strconv.Itoa(r.cfg.MaxLen))
+		}
+		// name and value as their own fields so consumers can filter without
+		// decoding; data is the full record.
+		cmd = append(cmd, "*", "name", s.Name, "value", strconv.FormatFloat(s.Value, 'f', -1, 64), "data", string(data))
+	} else {
+		cmd = []string{"PUBLISH", key, string(data)}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return err
+		}
+	}
+	if err := r.do(cmd...); err != nil {
+		r.close()
+		return err
+	}
+	return nil
+}
+
+func (r *redisSink) connect() error {
+	addr, useTLS := strings.CutPrefix(r.cfg.Address, "tls://")
+	addr = strings.TrimPrefix(addr, "redis://")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "6379")
+	}
+	d := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, nil)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	r.conn, r.r = conn, bufio.NewReader(conn)
+
+	if r.cfg.Password != "" {
+		auth := []string{"AUTH", r.cfg.Password}
+		if r.cfg.Username != "" {
+			auth = []string{"AUTH", r.cfg.Username, r.cfg.Password}
+		}
+		if err := r.do(auth...); err != nil {
+			r.close()
+			return fmt.Errorf("AUTH: %w", err)
+		}
+	}
+	if r.cfg.DB != 0 {
+		if err := r.do("SELECT", strconv.Itoa(r.cfg.DB)); err != nil {
+			r.close()
+			return fmt.Errorf("SELECT: %w", err)
+		}
+	}
+	return nil
+}
+
+// do sends one command and reads its reply, returning the reply if it's
+// an error.
+func (r *redisSink) do(args ...string) error {
+	var b []byte
+	b = fmt.Appendf(b, "*%d\r\n", len(args))
+	for _, a := range args {
+		b = fmt.Appendf(b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	r.conn.SetDeadline(time.Now().Add(redisTimeout))
+	if _, err := r.conn.Write(b); err != nil {
+		return err
+	}
+	return skipRESP(r.r)
+}
+
+// skipRESP reads one reply, discarding it unless it's an error.
+func skipRESP(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = io.CopyN(io.Discard, r, int64(n)+2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("malformed reply %q", line)
+		}
+		for range n {
+			if err := skipRESP(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected reply %q", line)
+}
+
+func (r *redisSink) close() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn, r.r = nil, nil
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// --- Retry Queue for Remote Sinks ---
+
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`    // Delivery attempts per sample before it is dropped
+	MaxQueue       int           `yaml:"max_queue"`       // Oldest samples are dropped beyond this
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // Doubled after each failed attempt
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// retrySink decouples a remote sink from collection: Send only enqueues,
+// and a single worker delivers in order, backing off exponentially while
+// the destination is failing. A successful delivery resets the backoff so
+// the backlog drains at full speed once the remote recovers.
+type retrySink struct {
+	inner Sink
+	cfg   RetryConfig
+
+	mu      sync.Mutex
+	queue   []Sample
+	head    uint64 // Samples ever removed from the front; identifies queue[0]
+	dropped uint64
+	wake    chan struct{}
+}
+
+func newRetrySink(inner Sink, cfg RetryConfig) *retrySink {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = 1000
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 1 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 1 * time.Minute
+	}
+
+	r := &retrySink{inner: inner, cfg: cfg, wake: make(chan struct{}, 1)}
+	registerSelfMetric(inner.Name()+"_queue_depth", func() float64 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return float64(len(r.queue))
+	})
+	registerSelfMetric(inner.Name()+"_dropped", func() float64 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return float64(r.dropped)
+	})
+	go r.run()
+	return r
+}
+
+// Unwrap returns the destination sink, bypassing the queue.
+func (r *retrySink) Unwrap() Sink { return r.inner }
+
+func (r *retrySink) Name() string { return r.inner.Name() }
+
+func (r *retrySink) Send(s Sample) error {
+	r.mu.Lock()
+	if len(r.queue) >= r.cfg.MaxQueue {
+		r.queue = r.queue[1:]
+		r.head++
+		r.dropped++
+	}
+	r.queue = append(r.queue, s)
+	r.mu.Unlock()
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// batchSender is implemented by destinations that take many samples per
+// request. The queue then collects samples for up to wait before handing
+// over as many as max at once, instead of delivering one at a time.
+type batchSender interface {
+	SendBatch(samples []Sample) error
+	batchLimits() (max int, wait time.Duration)
+}
+
+func (r *retrySink) run() {
+	backoff := r.cfg.InitialBackoff
+	attempts := 0
+	batch, _ := r.inner.(batchSender)
+
+	for {
+		r.mu.Lock()
+		if len(r.queue) == 0 {
+			r.mu.Unlock()
+			<-r.wake
+			if batch != nil {
+				_, wait := batch.batchLimits()
+				time.Sleep(wait)
+			}
+			continue
+		}
+		samples, id := r.queue[:1], r.head
+		if batch != nil {
+			max, _ := batch.batchLimits()
+			samples = r.queue[:min(len(r.queue), max)]
+		}
+		samples = append([]Sample(nil), samples...)
+		r.mu.Unlock()
+
+		var err error
+		if batch != nil {
+			err = batch.SendBatch(samples)
+		} else {
+			err = r.inner.Send(samples[0])
+		}
+		if err == nil {
+			r.pop(id, len(samples))
+			attempts = 0
+			backoff = r.cfg.InitialBackoff
+			continue
+		}
+
+		what := samples[0].Name
+		if len(samples) > 1 {
+			what = fmt.Sprintf("batch of %d", len(samples))
+		}
+		attempts++
+		if attempts >= r.cfg.MaxAttempts {
+			logErrorf("sink %s: dropping %s after %d attempts: %v", r.Name(), what, attempts, err)
+			r.mu.Lock()
+			r.dropped += uint64(len(samples))
+			r.mu.Unlock()
+			r.pop(id, len(samples))
+			attempts = 0
+		} else {
+			logWarnf("sink %s: %s: %v (retrying in %s)", r.Name(), what, err, backoff)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > r.cfg.MaxBackoff {
+			backoff = r.cfg.MaxBackoff
+		}
+	}
+}
+
+// pop removes the n samples starting at id, less any that overflow
+// already evicted.
+func (r *retrySink) pop(id uint64, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	drop := min(int(int64(id)+int64(n)-int64(r.head)), len(r.queue))
+	if drop > 0 {
+		r.queue = r.queue[drop:]
+		r.head += uint64(drop)
+	}
+}
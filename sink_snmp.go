@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- SNMP Trap Sink ---
+//
+// Sends an SNMPv2c or SNMPv3 (USM) trap whenever a metric's severity
+// changes: up to warn or crit, and back down to ok. The objects and
+// notifications are described in mibs/STAT-MONITOR-MIB.txt. BER encoding,
+// USM authentication (HMAC-MD5/SHA-96) and privacy (AES-128-CFB) are done
+// here so no SNMP library is needed.
+
+type SNMPTrapConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Target        string `yaml:"target"`         // host:port of the trap receiver; port defaults to 162
+	Version       string `yaml:"version"`        // 2c (default) or 3
+	Community     string `yaml:"community"`      // v2c, default "public"
+	EnterpriseOID string `yaml:"enterprise_oid"` // Root of the MIB, default 1.3.6.1.4.1.8072.9999.9999.1
+
+	// SNMPv3
+	User         string `yaml:"user"`
+	AuthProtocol string `yaml:"auth_protocol"` // SHA (default when auth_password is set) or MD5
+	AuthPassword string `yaml:"auth_password"`
+	PrivProtocol string `yaml:"priv_protocol"` // AES (the only one supported)
+	PrivPassword string `yaml:"priv_password"`
+	EngineID     string `yaml:"engine_id"` // Hex; default derived from the hostname
+}
+
+// The default root sits under NET-SNMP's netSnmpPlaypen, which is set aside
+// for local use, so it can't clash with a registered enterprise.
+const defaultSNMPEnterprise = "1.3.6.1.4.1.8072.9999.9999.1"
+
+var (
+	oidSysUpTime   = mustOID("1.3.6.1.2.1.1.3.0")
+	oidSnmpTrapOID = mustOID("1.3.6.1.6.3.1.1.4.1.0")
+)
+
+// snmpBootsKey is where snmpEngineBoots is kept in the state file.
+const snmpBootsKey = "_snmp_engine_boots"
+
+// BER tags used here.
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berOID         = 0x06
+	berSequence    = 0x30
+	berTimeTicks   = 0x43
+	berTrapV2      = 0xa7
+)
+
+type snmpTrapSink struct {
+	cfg        SNMPTrapConfig
+	enterprise []uint32
+	conn       *netConn
+	started    time.Time
+
+	// SNMPv3
+	engineID []byte
+	boots    int64 // snmpEngineBoots; engine time counts from started
+	authHash func() hash.Hash
+	authKey  []byte
+	privKey  []byte
+
+	mu       sync.Mutex
+	severity map[string]string // Last severity a trap was sent for, per metric
+	msgID    int32
+}
+
+func newSNMPTrapSink(cfg SNMPTrapConfig) (*snmpTrapSink, error) {
+	if _, _, err := net.SplitHostPort(cfg.Target); err != nil {
+		cfg.Target += ":162"
+	}
+	conn, err := newNetConn("udp", cfg.Target)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EnterpriseOID == "" {
+		cfg.EnterpriseOID = defaultSNMPEnterprise
+	}
+	enterprise, err := parseOID(cfg.EnterpriseOID)
+	if err != nil {
+		return nil, fmt.Errorf("enterprise_oid: %w", err)
+	}
+	if cfg.Community == "" {
+		cfg.Community = "public"
+	}
+	t := &snmpTrapSink{cfg: cfg, enterprise: enterprise, conn: conn, started: time.Now(), severity: map[string]string{}}
+
+	switch cfg.Version {
+	case "", "2c":
+	case "3":
+		if err := t.setupUSM(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown version %q (2c or 3)", cfg.Version)
+	}
+	return t, nil
+}
+
+func (t *snmpTrapSink) setupUSM() error {
+	c := t.cfg
+	if c.User == "" {
+		return fmt.Errorf("SNMPv3 needs a user")
+	}
+	if c.EngineID != "" {
+		id, err := hex.DecodeString(strings.TrimPrefix(c.EngineID, "0x"))
+		if err != nil || len(id) < 5 || len(id) > 32 {
+			return fmt.Errorf("engine_id must be 5-32 bytes of hex")
+		}
+		t.engineID = id
+	} else {
+		// RFC 3411 format: enterprise 8072 (net-snmp) with the high bit set,
+		// then format 4 (text) and the hostname, so it is stable across restarts.
+		name := hostName()
+		if len(name) > 27 {
+			name = name[:27]
+		}
+		t.engineID = append([]byte{0x80, 0x00, 0x1f, 0x88, 0x04}, name...)
+	}
+
+	// Receivers drop authenticated messages whose boots/time go backwards
+	// (RFC 3414 3.2 step 7), so every start has to count as a new boot.
+	// Without a state file that only holds until the first restart.
+	persisted.get(snmpBootsKey, &t.boots)
+	t.boots++
+	persisted.put(snmpBootsKey, t.boots)
+
+	if c.AuthPassword == "" {
+		if c.PrivPassword != "" {
+			return fmt.Errorf("priv_password requires auth_password")
+		}
+		return nil
+	}
+	switch strings.ToUpper(c.AuthProtocol) {
+	case "", "SHA":
+		t.authHash = sha1.New
+	case "MD5":
+		t.authHash = md5.New
+	default:
+		return fmt.Errorf("unknown auth_protocol %q (SHA or MD5)", c.AuthProtocol)
+	}
+	if len(c.AuthPassword) < 8 {
+		return fmt.Errorf("auth_password must be at least 8 characters")
+	}
+	t.authKey = usmLocalizedKey(t.authHash, c.AuthPassword, t.engineID)
+
+	if c.PrivPassword == "" {
+		return nil
+	}
+	if p := strings.ToUpper(c.PrivProtocol); p != "" && p != "AES" {
+		return fmt.Errorf("unknown priv_protocol %q (AES)", c.PrivProtocol)
+	}
+	if len(c.PrivPassword) < 8 {
+		return fmt.Errorf("priv_password must be at least 8 characters")
+	}
+	t.privKey = usmLocalizedKey(t.authHash, c.PrivPassword, t.engineID)[:16]
+	return nil
+}
+
+func (t *snmpTrapSink) Name() string { return "snmp_trap" }
+
+func (*snmpTrapSink) alerting() {}
+
+func (t *snmpTrapSink) Send(s Sample) error {
+	if s.Event != "" || s.Values != nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev, ok := t.severity[s.Name]
+	if !ok {
+		prev = "ok"
+	}
+	if s.Severity == prev {
+		return nil
+	}
+
+	// Notifications are <root>.0.N, objects <root>.1.N.0 (see the MIB).
+	notification := map[string]uint32{"warn": 1, "crit": 2, "ok": 3}[s.Severity]
+	if notification == 0 {
+		return nil
+	}
+	obj := func(n uint32) []uint32 { return append(append(append([]uint32(nil), t.enterprise...), 1, n), 0) }
+	uptime := uint32(time.Since(t.started) / (10 * time.Millisecond))
+
+	var vbs []byte
+	vbs = append(vbs, varbind(oidSysUpTime, berTLV(berTimeTicks, berUint(uint64(uptime))))...)
+	vbs = append(vbs, varbind(oidSnmpTrapOID, berTLV(berOID, berOIDBytes(append(append([]uint32(nil), t.enterprise...), 0, notification))))...)
+	vbs = append(vbs, varbind(obj(1), berString(s.Name))...)
+	vbs = append(vbs, varbind(obj(2), berString(strconv.FormatFloat(s.Value, 'f', -1, 64)))...)
+	vbs = append(vbs, varbind(obj(3), berString(s.Severity))...)
+	vbs = append(vbs, varbind(obj(4), berString(strconv.FormatFloat(s.Threshold, 'f', -1, 64)))...)
+	vbs = append(vbs, varbind(obj(5), berString(hostName()))...)
+	vbs = append(vbs, varbind(obj(6), berString(s.Text()))...)
+
+	t.msgID++
+	pdu := berTLV(berTrapV2, concat(
+		berInt(int64(t.msgID)), berInt(0), berInt(0),
+		berTLV(berSequence, vbs),
+	))
+	var msg []byte
+	if t.cfg.Version == "3" {
+		var err error
+		if msg, err = t.wrapV3(pdu); err != nil {
+			return err
+		}
+	} else {
+		msg = berTLV(berSequence, concat(berInt(1), berString(t.cfg.Community), pdu))
+	}
+	if err := t.conn.write(msg); err != nil {
+		return err
+	}
+	t.severity[s.Name] = s.Severity
+	return nil
+}
+
+// wrapV3 builds an SNMPv3 message around pdu with the USM security model,
+// authenticating and encrypting it as configured. We are the authoritative
+// engine for traps, so no discovery exchange is needed.
+func (t *snmpTrapSink) wrapV3(pdu []byte) ([]byte, error) {
+	boots := t.boots
+	engineTime := int64(time.Since(t.started) / time.Second)
+	var flags byte
+	if t.authKey != nil {
+		flags |= 0x01
+	}
+
+	scoped := berTLV(berSequence, concat(berString(string(t.engineID)), berString(""), pdu))
+	var privParams []byte
+	if t.privKey != nil {
+		flags |= 0x02
+		salt := make([]byte, 8)
+		rand.Read(salt)
+		iv := binary.BigEndian.AppendUint32(nil, uint32(boots))
+		iv = binary.BigEndian.AppendUint32(iv, uint32(engineTime))
+		iv = append(iv, salt...)
+		block, err := aes.NewCipher(t.privKey)
+		if err != nil {
+			return nil, err
+		}
+		encrypted := make([]byte, len(scoped))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, scoped)
+		scoped = berTLV(berOctetString, encrypted)
+		privParams = salt
+	}
+
+	// The HMAC covers the whole message with the auth parameters zeroed;
+	// a random placeholder marks where to put it afterwards.
+	var authParams []byte
+	if t.authKey != nil {
+		authParams = make([]byte, 12)
+		rand.Read(authParams)
+	}
+	secParams := berTLV(berSequence, concat(
+		berString(string(t.engineID)), berInt(boots), berInt(engineTime),
+		berString(t.cfg.User), berString(string(authParams)), berString(string(privParams)),
+	))
+	t.msgID++
+	header := berTLV(berSequence, concat(berInt(int64(t.msgID)), berInt(65507), berString(string([]byte{flags})), berInt(3)))
+	msg := berTLV(berSequence, concat(berInt(3), header, berString(string(secParams)), scoped))
+
+	if t.authKey != nil {
+		at := bytes.Index(msg, authParams)
+		copy(msg[at:], make([]byte, 12))
+		mac := hmac.New(t.authHash, t.authKey)
+		mac.Write(msg)
+		copy(msg[at:], mac.Sum(nil)[:12])
+	}
+	return msg, nil
+}
+
+// usmLocalizedKey is RFC 3414's password-to-key (A.2) followed by key
+// localization to the engine ID.
+func usmLocalizedKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+	h := newHash()
+	pw := []byte(password)
+	buf := make([]byte, 64)
+	for n, i := 0, 0; n < 1<<20; n += 64 {
+		for j := range buf {
+			buf[j] = pw[i%len(pw)]
+			i++
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+	h = newHash()
+	h.Write(ku)
+	h.Write(engineID)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// --- BER encoding ---
+
+func berTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	n := len(content)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// berInt encodes a non-negative INTEGER; nothing here sends negative ones.
+func berInt(v int64) []byte {
+	return berTLV(berInteger, berUint(uint64(v)))
+}
+
+// berUint is the minimal big-endian form of v, keeping a leading zero
+// byte where the top bit would otherwise read as a sign.
+func berUint(v uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	for len(b) > 1 && b[0] == 0 && b[1] < 0x80 {
+		b = b[1:]
+	}
+	return b
+}
+
+func berString(s string) []byte { return berTLV(berOctetString, []byte(s)) }
+
+func berOIDBytes(oid []uint32) []byte {
+	out := []byte{byte(oid[0]*40 + oid[1])}
+	for _, n := range oid[2:] {
+		var tmp []byte
+		tmp = append(tmp, byte(n&0x7f))
+		for n >>= 7; n > 0; n >>= 7 {
+			tmp = append(tmp, byte(n&0x7f)|0x80)
+		}
+		for i := len(tmp) - 1; i >= 0; i-- {
+			out = append(out, tmp[i])
+		}
+	}
+	return out
+}
+
+func varbind(oid []uint32, value []byte) []byte {
+	return berTLV(berSequence, concat(berTLV(berOID, berOIDBytes(oid)), value))
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func parseOID(s string) ([]uint32, error) {
+	var oid []uint32
+	for _, p := range strings.Split(strings.TrimPrefix(s, "."), ".") {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad OID %q", s)
+		}
+		oid = append(oid, uint32(n))
+	}
+	if len(oid) < 2 || oid[0] > 2 || oid[1] >= 40 {
+		return nil, fmt.Errorf("bad OID %q", s)
+	}
+	return oid, nil
+}
+
+func mustOID(s string) []uint32 {
+	oid, err := parseOID(s)
+	if err != nil {
+		panic(err)
+	}
+	return oid
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func TestBERUint(t *testing.T) {
+	tests := []struct {
+		in   uint64
+		want string
+	}{
+		{0, "00"},
+		{1, "01"},
+		{127, "7f"},
+		{128, "0080"}, // Leading zero keeps it positive
+		{255, "00ff"},
+		{256, "0100"},
+		{65507, "00ffe3"},
+		{0x7fffffff, "7fffffff"},
+		{0xffffffff, "00ffffffff"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(berUint(tt.in)); got != tt.want {
+			t.Errorf("berUint(%d) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBERTLV(t *testing.T) {
+	tests := []struct {
+		n    int // Content length
+		want string
+	}{
+		{0, "0400"},
+		{0x7f, "047f"},
+		{0x80, "048180"}, // Long form from 128 on
+		{0xff, "0481ff"},
+		{0x100, "04820100"},
+		{1400, "04820578"},
+	}
+	for _, tt := range tests {
+		got := berTLV(berOctetString, make([]byte, tt.n))
+		if head := hex.EncodeToString(got[:len(got)-tt.n]); head != tt.want {
+			t.Errorf("length %d: header %s, want %s", tt.n, head, tt.want)
+		}
+	}
+	if got := hex.EncodeToString(berInt(7)); got != "020107" {
+		t.Errorf("berInt(7) = %s, want 020107", got)
+	}
+}
+
+func TestBEROID(t *testing.T) {
+	tests := []struct {
+		oid  string
+		want string
+	}{
+		{"1.3.6.1.2.1.1.3.0", "2b06010201010300"},
+		{"1.3.6.1.6.3.1.1.4.1.0", "2b060106030101040100"},
+		{defaultSNMPEnterprise, "2b06010401bf08ce0fce0f01"}, // 8072 and 9999 take two bytes
+		{"1.3.6.1.4.1.4294967295", "2b060104018fffffff7f"},  // Largest arc
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(berOIDBytes(mustOID(tt.oid))); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.oid, got, tt.want)
+		}
+	}
+}
+
+// RFC 3414 A.3: password "maplesyrup", engine ID 00..02.
+func TestUSMLocalizedKey(t *testing.T) {
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	tests := []struct {
+		name string
+		hash func() hash.Hash
+		want string
+	}{
+		{"MD5", md5.New, "526f5eed9fcce26f8964c2930787d82b"},
+		{"SHA", sha1.New, "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(usmLocalizedKey(tt.hash, "maplesyrup", engineID)); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// ber is one decoded TLV.
+type ber struct {
+	tag     byte
+	content []byte
+}
+
+// berItems splits b into its TLVs, failing the test on bad encoding.
+func berItems(t *testing.T, b []byte) []ber {
+	t.Helper()
+	var out []ber
+	for len(b) > 0 {
+		if len(b) < 2 {
+			t.Fatalf("truncated TLV % x", b)
+		}
+		tag, n, head := b[0], int(b[1]), 2
+		switch b[1] {
+		case 0x81:
+			n, head = int(b[2]), 3
+		case 0x82:
+			n, head = int(binary.BigEndian.Uint16(b[2:])), 4
+		}
+		if len(b) < head+n {
+			t.Fatalf("TLV %#x wants %d bytes, has %d", tag, n, len(b)-head)
+		}
+		out = append(out, ber{tag, b[head : head+n]})
+		b = b[head+n:]
+	}
+	return out
+}
+
+// berSeq decodes b as one TLV with the given tag and returns its items.
+func berSeq(t *testing.T, b []byte, tag byte, want int) []ber {
+	t.Helper()
+	items := berItems(t, b)
+	if len(items) != 1 || items[0].tag != tag {
+		t.Fatalf("want one %#x TLV, got %d items", tag, len(items))
+	}
+	inner := berItems(t, items[0].content)
+	if len(inner) != want {
+		t.Fatalf("%#x has %d items, want %d", tag, len(inner), want)
+	}
+	return inner
+}
+
+func (b ber) int() int64 {
+	var v int64
+	for _, c := range b.content {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// withState swaps in an empty state store holding the given entries.
+func withState(t *testing.T, entries map[string]any) {
+	t.Helper()
+	old := persisted
+	persisted = &stateStore{m: map[string]json.RawMessage{}}
+	for k, v := range entries {
+		persisted.put(k, v)
+	}
+	t.Cleanup(func() { persisted = old })
+}
+
+// checkTrapPDU checks the trap PDU a receiver would decode.
+func checkTrapPDU(t *testing.T, pdu ber, s Sample) {
+	t.Helper()
+	items := berItems(t, pdu.content)
+	if pdu.tag != berTrapV2 || len(items) != 4 {
+		t.Fatalf("PDU tag %#x with %d items, want a trap with 4", pdu.tag, len(items))
+	}
+	vbs := berItems(t, items[3].content)
+	if len(vbs) != 8 {
+		t.Fatalf("%d varbinds, want 8", len(vbs))
+	}
+	trapOID := berItems(t, vbs[1].content)
+	want := berOIDBytes(append(mustOID(defaultSNMPEnterprise), 0, 2)) // crit
+	if !bytes.Equal(trapOID[0].content, berOIDBytes(oidSnmpTrapOID)) || !bytes.Equal(trapOID[1].content, want) {
+		t.Fatalf("snmpTrapOID varbind % x", vbs[1].content)
+	}
+	var values []string
+	for _, vb := range vbs[2:7] {
+		values = append(values, string(berItems(t, vb.content)[1].content))
+	}
+	if got := strings.Join(values, " "); got != s.Name+" 93.5 crit 90 "+hostName() {
+		t.Fatalf("varbind values %q", got)
+	}
+}
+
+var trapSample = Sample{Name: "disk_root", Value: 93.5, Severity: "crit", Threshold: 90, Time: testStart}
+
+func TestSNMPTrapV2c(t *testing.T) {
+	addr, read := udpListener(t)
+	sink, err := newSNMPTrapSink(SNMPTrapConfig{Target: addr, Community: "c0mm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(trapSample); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	packets := read()
+	if len(packets) != 1 {
+		t.Fatalf("%d packets, want 1", len(packets))
+	}
+	msg := berSeq(t, []byte(packets[0]), berSequence, 3)
+	if msg[0].int() != 1 || string(msg[1].content) != "c0mm" {
+		t.Fatalf("version %d community %q, want 1 (v2c) and c0mm", msg[0].int(), msg[1].content)
+	}
+	checkTrapPDU(t, msg[2], trapSample)
+}
+
+// TestSNMPTrapV3 decodes an authenticated, encrypted trap the way a receiver
+// would, with keys from RFC 3414 A.3 rather than from the code under test.
+func TestSNMPTrapV3(t *testing.T) {
+	withState(t, map[string]any{snmpBootsKey: 6})
+	addr, read := udpListener(t)
+	sink, err := newSNMPTrapSink(SNMPTrapConfig{
+		Target: addr, Version: "3", User: "statmon",
+		AuthProtocol: "SHA", AuthPassword: "maplesyrup",
+		PrivProtocol: "AES", PrivPassword: "maplesyrup",
+		EngineID: "000000000000000000000002",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(trapSample); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	packets := read()
+	if len(packets) != 1 {
+		t.Fatalf("%d packets, want 1", len(packets))
+	}
+	raw := []byte(packets[0])
+
+	msg := berSeq(t, raw, berSequence, 4)
+	if msg[0].int() != 3 {
+		t.Fatalf("version %d, want 3", msg[0].int())
+	}
+	header := berItems(t, msg[1].content)
+	if len(header) != 4 || !bytes.Equal(header[2].content, []byte{0x03}) || header[3].int() != 3 {
+		t.Fatalf("header % x, want flags auth|priv and USM", msg[1].content)
+	}
+	usm := berSeq(t, msg[2].content, berSequence, 6)
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	if !bytes.Equal(usm[0].content, engineID) || usm[1].int() != 7 || string(usm[3].content) != "statmon" {
+		t.Fatalf("engine %x boots %d user %q, want boots 7 after 6 saved", usm[0].content, usm[1].int(), usm[3].content)
+	}
+	authParams, salt := usm[4].content, usm[5].content
+	if len(authParams) != 12 || len(salt) != 8 {
+		t.Fatalf("auth params %d bytes, priv params %d, want 12 and 8", len(authParams), len(salt))
+	}
+
+	key, _ := hex.DecodeString("6695febc9288e36282235fc7151f128497b38f3f")
+	// HMAC-SHA-96 over the whole message with the auth params zeroed.
+	zeroed := bytes.Clone(raw)
+	at := bytes.Index(zeroed, authParams)
+	copy(zeroed[at:], make([]byte, 12))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(zeroed)
+	if want := mac.Sum(nil)[:12]; !bytes.Equal(authParams, want) {
+		t.Fatalf("auth params %x, want %x", authParams, want)
+	}
+
+	// RFC 3826 3.1.2.1: IV = boots || time || salt, AES-128-CFB with the
+	// first 16 bytes of the localized key.
+	if msg[3].tag != berOctetString {
+		t.Fatalf("scoped PDU tag %#x, want encrypted octet string", msg[3].tag)
+	}
+	iv := binary.BigEndian.AppendUint32(nil, uint32(usm[1].int()))
+	iv = binary.BigEndian.AppendUint32(iv, uint32(usm[2].int()))
+	iv = append(iv, salt...)
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoped := make([]byte, len(msg[3].content))
+	cipher.NewCFBDecrypter(block, iv).XORKeyStream(scoped, msg[3].content)
+
+	items := berSeq(t, scoped, berSequence, 3)
+	if !bytes.Equal(items[0].content, engineID) || len(items[1].content) != 0 {
+		t.Fatalf("context engine %x name %q", items[0].content, items[1].content)
+	}
+	checkTrapPDU(t, items[2], trapSample)
+}
+
+func TestSNMPTrapV3AuthOnly(t *testing.T) {
+	withState(t, nil)
+	addr, read := udpListener(t)
+	sink, err := newSNMPTrapSink(SNMPTrapConfig{
+		Target: addr, Version: "3", User: "statmon",
+		AuthProtocol: "MD5", AuthPassword: "maplesyrup",
+		EngineID: "000000000000000000000002",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(trapSample); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	raw := []byte(read()[0])
+	msg := berSeq(t, raw, berSequence, 4)
+	if flags := berItems(t, msg[1].content)[2].content; !bytes.Equal(flags, []byte{0x01}) {
+		t.Fatalf("flags % x, want auth only", flags)
+	}
+	usm := berSeq(t, msg[2].content, berSequence, 6)
+	if usm[1].int() != 1 || len(usm[5].content) != 0 {
+		t.Fatalf("boots %d, priv params % x; want 1 and none", usm[1].int(), usm[5].content)
+	}
+	authParams := usm[4].content
+	zeroed := bytes.Clone(raw)
+	copy(zeroed[bytes.Index(zeroed, authParams):], make([]byte, 12))
+	key, _ := hex.DecodeString("526f5eed9fcce26f8964c2930787d82b")
+	mac := hmac.New(md5.New, key)
+	mac.Write(zeroed)
+	if want := mac.Sum(nil)[:12]; !bytes.Equal(authParams, want) {
+		t.Fatalf("auth params %x, want %x", authParams, want)
+	}
+	if msg[3].tag != berSequence {
+		t.Fatalf("scoped PDU tag %#x, want a plaintext sequence", msg[3].tag)
+	}
+	items := berItems(t, msg[3].content)
+	checkTrapPDU(t, items[2], trapSample)
+}
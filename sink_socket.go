@@ -0,0 +1,36 @@
+package main
+
+import "encoding/json"
+
+// --- Socket Sink ---
+
+type SocketOutputConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Address  string `yaml:"address"`  // host:port of the listener, or a socket path for unix/unixgram
+	Protocol string `yaml:"protocol"` // tcp (default), udp, unix (stream) or unixgram (datagram)
+}
+
+// socketSink writes the same JSON record as the file sink, one object per
+// line, to a TCP or unix stream, or as one datagram per broadcast.
+type socketSink struct {
+	conn *netConn
+}
+
+func newSocketSink(cfg SocketOutputConfig) (*socketSink, error) {
+	conn, err := newNetConn(cfg.Protocol, cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &socketSink{conn: conn}, nil
+}
+
+func (s *socketSink) Name() string { return "socket" }
+
+func (s *socketSink) Send(sample Sample) error {
+	line, err := json.Marshal(newSampleRecord(sample))
+	if err != nil {
+		return err
+	}
+	return s.conn.write(append(line, '\n'))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --- StatsD Sink ---
+
+type StatsDConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Address string `yaml:"address"` // host:port, usually :8125
+	Prefix  string `yaml:"prefix"`  // Prepended as "<prefix>.<metric>"; {host} allowed
+	Tags    bool   `yaml:"tags"`    // Append DogStatsD tags (host, path, interface, ...)
+}
+
+// statsdSink sends every broadcast as a gauge over UDP.
+type statsdSink struct {
+	cfg  StatsDConfig
+	conn *netConn
+}
+
+func newStatsDSink(cfg StatsDConfig) (*statsdSink, error) {
+	conn, err := newNetConn("udp", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{cfg: cfg, conn: conn}, nil
+}
+
+func (s *statsdSink) Name() string { return "statsd" }
+
+func (s *statsdSink) Send(sample Sample) error {
+	if sample.Event != "" {
+		return nil
+	}
+	var b strings.Builder
+	if sample.Values != nil {
+		for _, name := range sortedKeys(sample.Values) {
+			s.gauge(&b, "summary."+name, sample.Values[name], nil)
+		}
+	} else {
+		s.gauge(&b, sample.Name, sample.Value, sample.Tags)
+	}
+	return s.conn.writeLines([]byte(b.String()))
+}
+
+// gauge appends one gauge line. A leading sign means "adjust by" in StatsD,
+// so a negative gauge is first reset to 0 and then set.
+func (s *statsdSink) gauge(b *strings.Builder, name string, v float64, tags map[string]string) {
+	name = statsdName(name)
+	if s.cfg.Prefix != "" {
+		name = statsdName(expandName(s.cfg.Prefix, "")) + "." + name
+	}
+	suffix := ""
+	if s.cfg.Tags {
+		all := []string{"host:" + hostName()}
+		for k, tv := range tags {
+			all = append(all, k+":"+strings.NewReplacer(",", "_", "|", "_").Replace(tv))
+		}
+		sort.Strings(all[1:])
+		suffix = "|#" + strings.Join(all, ",")
+	}
+	if v < 0 {
+		fmt.Fprintf(b, "%s:0|g%s\n", name, suffix)
+	}
+	fmt.Fprintf(b, "%s:%g|g%s\n", name, v, suffix)
+}
+
+// statsdName drops the characters that delimit a StatsD line.
+func statsdName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, name)
+}
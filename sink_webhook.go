@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// --- Webhook Sink ---
+
+type WebhookConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`  // Default POST
+	Headers map[string]string `yaml:"headers"` // e.g. Authorization
+	Timeout time.Duration     `yaml:"timeout"` // Per request, default 10s
+}
+
+// webhookSink sends each broadcast as one JSON request. Any non-2xx reply
+// is an error, so the retry queue backs off and tries again.
+type webhookSink struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// webhookBody is the shared JSON record plus the human-readable line.
+type webhookBody struct {
+	sampleRecord
+	Text string `json:"text"`
+}
+
+func newWebhookSink(cfg WebhookConfig) (*webhookSink, error) {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if _, err := http.NewRequest(cfg.Method, cfg.URL, nil); err != nil {
+		return nil, err
+	}
+	return &webhookSink{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+func (w *webhookSink) Name() string { return "webhook" }
+
+func (w *webhookSink) Send(s Sample) error {
+	body, err := json.Marshal(webhookBody{sampleRecord: newSampleRecord(s), Text: s.Text()})
+	if err != nil {
+		return err
+	}
+	return httpSend(w.client, w.cfg.Method, w.cfg.URL, "application/json", w.cfg.Headers, body)
+}
+
+// httpSend sends body and turns a non-2xx status into an error carrying
+// the start of the response, which usually says what was wrong.
+func httpSend(client *http.Client, method, url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "stat-monitor")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body) // Drain so the connection is reused
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// --- Zabbix Sender Sink ---
+//
+// Pushes values to trapper items on a Zabbix server or proxy using the
+// sender protocol (what zabbix_sender speaks): a "ZBXD" header and a JSON
+// "sender data" request, one connection per batch.
+
+type ZabbixConfig struct {
+	OutputToggle `yaml:",inline"`
+
+	Server        string                `yaml:"server"`         // host:port of the server or proxy; port defaults to 10051
+	Host          string                `yaml:"host"`           // Zabbix host name, default the hostname
+	Key           string                `yaml:"key"`            // Item key pattern, default "stat_monitor[{metric}]"
+	Items         map[string]ZabbixItem `yaml:"items"`          // Per-metric overrides, keyed by metric name
+	FlushInterval time.Duration         `yaml:"flush_interval"` // Batch window, default 1s
+}
+
+// ZabbixItem maps one metric to a specific host and/or item key.
+type ZabbixItem struct {
+	Host string `yaml:"host"`
+	Key  string `yaml:"key"`
+}
+
+const (
+	zabbixTimeout   = 10 * time.Second
+	zabbixMaxValues = 250 // Per request, as zabbix_sender batches
+)
+
+type zabbixSink struct {
+	cfg ZabbixConfig
+}
+
+type zabbixValue struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+	NS    int    `json:"ns"`
+}
+
+func newZabbixSink(cfg ZabbixConfig) (*zabbixSink, error) {
+	if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+		cfg.Server = net.JoinHostPort(cfg.Server, "10051")
+	}
+	if cfg.Host == "" {
+		cfg.Host = "{host}"
+	}
+	if cfg.Key == "" {
+		cfg.Key = "stat_monitor[{metric}]"
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	return &zabbixSink{cfg: cfg}, nil
+}
+
+func (z *zabbixSink) Name() string { return "zabbix" }
+
+func (z *zabbixSink) Send(s Sample) error {
+	return z.SendBatch([]Sample{s})
+}
+
+func (z *zabbixSink) batchLimits() (int, time.Duration) {
+	return zabbixMaxValues, z.cfg.FlushInterval
+}
+
+var zabbixFailed = regexp.MustCompile(`failed: (\d+)`)
+
+func (z *zabbixSink) SendBatch(samples []Sample) error {
+	var data []zabbixValue
+	for _, s := range samples {
+		// Events and summaries have no item to go to.
+		if s.Event != "" || s.Values != nil {
+			continue
+		}
+		host, key := z.cfg.Host, z.cfg.Key
+		if item, ok := z.cfg.Items[s.Name]; ok {
+			if item.Host != "" {
+				host = item.Host
+			}
+			if item.Key != "" {
+				key = item.Key
+			}
+		}
+		data = append(data, zabbixValue{
+			Host:  expandName(host, s.Name),
+			Key:   expandName(key, s.Name),
+			Value: strconv.FormatFloat(s.Value, 'f', -1, 64),
+			Clock: s.Time.Unix(),
+			NS:    s.Time.Nanosecond(),
+		})
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	req, err := json.Marshal(map[string]any{"request": "sender data", "data": data, "clock": time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+	resp, err := z.exchange(req)
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(resp, &reply); err != nil {
+		return fmt.Errorf("bad reply: %w", err)
+	}
+	if reply.Response != "success" {
+		return fmt.Errorf("server replied %q: %s", reply.Response, reply.Info)
+	}
+	// Values for unknown hosts/items are rejected individually. Resending
+	// won't help, so report it rather than retry.
+	if m := zabbixFailed.FindStringSubmatch(reply.Info); m != nil && m[1] != "0" {
+		logWarnf("sink zabbix: %s (check that the trapper items exist and allow this host)", reply.Info)
+	}
+	return nil
+}
+
+// exchange sends one framed request and reads the framed reply.
+func (z *zabbixSink) exchange(req []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", z.cfg.Server, zabbixTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(zabbixTimeout))
+
+	msg := append([]byte("ZBXD\x01"), binary.LittleEndian.AppendUint64(nil, uint64(len(req)))...)
+	if _, err := conn.Write(append(msg, req...)); err != nil {
+		return nil, err
+	}
+	var head [13]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+	if string(head[:4]) != "ZBXD" {
+		return nil, errors.New("reply is not a Zabbix message")
+	}
+	if head[4]&0x02 != 0 {
+		return nil, errors.New("compressed replies are not supported")
+	}
+	size := binary.LittleEndian.Uint32(head[5:9])
+	if size > 1<<20 {
+		return nil, fmt.Errorf("reply too large (%d bytes)", size)
+	}
+	resp := make([]byte, size)
+	_, err = io.ReadFull(conn, resp)
+	return resp, err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// --- SMART Disk Health ---
+//
+// Read with smartctl's JSON output (smartmontools 7.0+), which knows the
+// quirks of every drive family. Sleeping disks are left alone (-n standby);
+// their sample is skipped rather than spinning them up. Every smart metric
+// on a device shares one smartctl run per tick.
+
+// smartReport is the part of `smartctl -j -a` used here.
+type smartReport struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String string `json:"string"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	ATAAttributes *struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value float64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeLog *struct {
+		PercentageUsed float64 `json:"percentage_used"`
+		MediaErrors    float64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	Temperature *struct {
+		Current float64 `json:"current"`
+	} `json:"temperature"`
+}
+
+// ATA attribute IDs.
+const (
+	ataReallocatedSectors = 5
+	ataPendingSectors     = 197
+)
+
+func readSMART(ctx context.Context, device string) (*smartReport, error) {
+	path, err := exec.LookPath("smartctl")
+	if err != nil {
+		return nil, fmt.Errorf("smartctl not found: %w", errUnsupported)
+	}
+	// smartctl's exit status is a bit mask that is also set for warnings
+	// and a failing disk, so the JSON is what counts.
+	out, _ := exec.CommandContext(ctx, path, "-j", "-a", "-n", "standby", device).Output()
+	var r smartReport
+	if err := json.Unmarshal(out, &r); err != nil {
+		return nil, fmt.Errorf("smartctl %s: no JSON output (smartmontools 7.0+ needed)", device)
+	}
+	var msgs []string
+	for _, m := range r.Smartctl.Messages {
+		if strings.Contains(m.String, "STANDBY") {
+			return nil, fmt.Errorf("%s in standby: %w", device, errNotReady)
+		}
+		msgs = append(msgs, m.String)
+	}
+	// Bits 0-2: bad arguments, device open failed, or command failed.
+	if r.Smartctl.ExitStatus&0x7 != 0 && r.SmartStatus == nil {
+		return nil, fmt.Errorf("smartctl %s: %s", device, strings.Join(msgs, "; "))
+	}
+	return &r, nil
+}
+
+// smartValue reads one measure for device: healthy (the default; 1 when
+// the drive's overall self-assessment passes), reallocated_sectors and
+// pending_sectors (ATA), percentage_used and media_errors (NVMe), or
+// temperature.
+func smartValue(ctx context.Context, device, measure string) (float64, error) {
+	if device == "" {
+		return 0, fmt.Errorf("set device, or per_device: true")
+	}
+	r, err := currentTick().smart(ctx, device)
+	if err != nil {
+		return 0, err
+	}
+	notReported := fmt.Errorf("%s does not report %s", device, measure)
+
+	switch measure {
+	case "healthy", "":
+		if r.SmartStatus == nil {
+			return 0, notReported
+		}
+		if r.SmartStatus.Passed {
+			return 1, nil
+		}
+		return 0, nil
+	case "reallocated_sectors", "pending_sectors":
+		id := ataReallocatedSectors
+		if measure == "pending_sectors" {
+			id = ataPendingSectors
+		}
+		if r.ATAAttributes != nil {
+			for _, a := range r.ATAAttributes.Table {
+				if a.ID == id {
+					return a.Raw.Value, nil
+				}
+			}
+		}
+		return 0, notReported
+	case "percentage_used", "media_errors":
+		if r.NVMeLog == nil {
+			return 0, notReported
+		}
+		if measure == "media_errors" {
+			return r.NVMeLog.MediaErrors, nil
+		}
+		return r.NVMeLog.PercentageUsed, nil
+	case "temperature":
+		if r.Temperature == nil {
+			return 0, notReported
+		}
+		return r.Temperature.Current, nil
+	}
+	return 0, fmt.Errorf("unknown smart measure %q", measure)
+}
+
+// smartDevices lists the disks smartctl finds, for per_device.
+func smartDevices(ctx context.Context) ([]string, error) {
+	path, err := exec.LookPath("smartctl")
+	if err != nil {
+		return nil, fmt.Errorf("smartctl not found: %w", errUnsupported)
+	}
+	out, err := exec.CommandContext(ctx, path, "-j", "--scan").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+	}
+	var scan struct {
+		Devices []struct {
+			Name string `json:"name"`
+		} `json:"devices"`
+	}
+	if err := json.Unmarshal(out, &scan); err != nil {
+		return nil, fmt.Errorf("smartctl --scan: %w", err)
+	}
+	var names []string
+	for _, d := range scan.Devices {
+		names = append(names, d.Name)
+	}
+	return names, nil
+}
+
+// smartDeviceKey is the metric key suffix for a device: /dev/sda -> sda.
+func smartDeviceKey(device string) string {
+	return sanitizeName(filepath.Base(device))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+)
+
+// --- Summary Broadcast ---
+
+// broadcastSummary sends one "summary" sample holding the last broadcast
+// value of every metric, for consumers that just want the current state.
+func broadcastSummary(states map[string]*MetricState) {
+	values := make(map[string]float64, len(states))
+	for name := range states {
+		if st := metricCache.statusOf(name); !st.LastBroadcast.IsZero() {
+			values[name] = st.LastValue
+		}
+	}
+
+	sample := Sample{Name: "summary", Time: time.Now(), Severity: "ok", Values: values}
+	for _, sink := range sinks {
+		if err := sink.Send(sample); err != nil {
+			logErrorf("sink %s: summary: %v", sink.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// tcpCheck dials host:port and reports either the handshake latency in
+// milliseconds ("connect_ms") or plain reachability ("reachable", 1/0).
+//
+// Name resolution is done separately so a DNS failure surfaces as a
+// collection error, while a refused or timed-out connection is a valid
+// reading of 0 for "reachable".
+func tcpCheck(ctx context.Context, host string, port int, measure string) (float64, error) {
+	if host == "" || port <= 0 {
+		return 0, fmt.Errorf("tcp_check needs host and port")
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return 0, fmt.Errorf("resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return 0, fmt.Errorf("resolve %s: no addresses", host)
+	}
+
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], strconv.Itoa(port)))
+	elapsed := time.Since(start)
+
+	if measure == "connect_ms" {
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+		return float64(elapsed.Microseconds()) / 1000, nil
+	}
+
+	// Default measure: reachable
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			return 0.0, nil
+		}
+		return 0, err
+	}
+	conn.Close()
+	return 1.0, nil
+}
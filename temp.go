@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// tempValue reads the temperature sensors whose key matches sensor (a glob
+// such as "coretemp_package_id_*" or "nvme_*"; empty means all) and
+// combines them by aggregate: max (default), min or avg.
+func tempValue(ctx context.Context, sensor, aggregate string) (float64, error) {
+	temps, err := temperatures(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pattern := strings.ToLower(sensor)
+	var values []float64
+	for _, t := range temps {
+		if ok, _ := filepath.Match(pattern, strings.ToLower(t.SensorKey)); sensor == "" || ok {
+			values = append(values, t.Temperature)
+		}
+	}
+	if len(values) == 0 {
+		keys := make([]string, len(temps))
+		for i, t := range temps {
+			keys[i] = t.SensorKey
+		}
+		sort.Strings(keys)
+		return 0, fmt.Errorf("no sensor matches %q (have %s)", sensor, strings.Join(keys, ", "))
+	}
+
+	v := values[0]
+	for _, x := range values[1:] {
+		switch aggregate {
+		case "min":
+			v = min(v, x)
+		case "avg":
+			v += x
+		default:
+			v = max(v, x)
+		}
+	}
+	if aggregate == "avg" {
+		v /= float64(len(values))
+	}
+	return v, nil
+}
+
+// temperatures returns every sensor reading. gopsutil returns what it
+// could read along with warnings for the rest, so its results are used
+// whenever there are any. It skips hwmon chips without a name file, and
+// only looks under device/ when no chip has direct inputs; hwmonTemps
+// covers those cases.
+func temperatures(ctx context.Context) ([]host.TemperatureStat, error) {
+	temps, err := host.SensorsTemperaturesWithContext(ctx)
+	if len(temps) > 0 {
+		return temps, nil
+	}
+	if temps := hwmonTemps(); len(temps) > 0 {
+		return temps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading sensors: %w", err)
+	}
+	return nil, fmt.Errorf("no temperature sensors: %w", errUnsupported)
+}
+
+// hwmonTemps reads /sys/class/hwmon directly, keying sensors like gopsutil
+// does: "<chip name>_<label>", e.g. "nvme_composite".
+func hwmonTemps() []host.TemperatureStat {
+	direct, _ := filepath.Glob("/sys/class/hwmon/hwmon*/temp*_input")
+	nested, _ := filepath.Glob("/sys/class/hwmon/hwmon*/device/temp*_input")
+	var temps []host.TemperatureStat
+	for _, file := range append(direct, nested...) {
+		dir := filepath.Dir(file)
+		chip := strings.TrimSuffix(dir, "/device")
+		name := readSysString(filepath.Join(chip, "name"))
+		if name == "" {
+			name = filepath.Base(chip)
+		}
+		base := filepath.Join(dir, strings.TrimSuffix(filepath.Base(file), "_input"))
+		if label := readSysString(base + "_label"); label != "" {
+			name += "_" + strings.ReplaceAll(strings.ToLower(label), " ", "_")
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+		if err != nil {
+			continue
+		}
+		temps = append(temps, host.TemperatureStat{SensorKey: name, Temperature: milli / 1000})
+	}
+	return temps
+}
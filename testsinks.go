@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// --- Sink Self-Test (-test-sinks) ---
+
+// sinkTestTimeout bounds each sink's delivery attempt.
+const sinkTestTimeout = 10 * time.Second
+
+// testSinks sends one synthetic sample through every configured sink and
+// prints the outcome per sink. Queued sinks are tested on the destination
+// itself, since their Send only enqueues and can't report a failure.
+// Alerting sinks only send on a severity change, so they get a crit sample
+// followed by its recovery instead: an ok sample alone would be dropped
+// without reaching the destination, and the recovery closes any incident
+// the test opened. It returns the number of sinks that failed.
+func testSinks(w io.Writer, sinks []Sink) int {
+	host, _ := os.Hostname()
+	sample := Sample{
+		Name:     "stat_monitor_test",
+		Value:    1,
+		Time:     time.Now(),
+		Severity: "ok",
+		Message:  fmt.Sprintf("stat-monitor sink test from %s", host),
+	}
+	breach := sample
+	breach.Severity = "crit"
+	breach.Threshold = 1
+
+	if len(sinks) == 0 {
+		fmt.Fprintln(w, "no sinks configured")
+		return 0
+	}
+	failed := 0
+	for _, sink := range sinks {
+		target := sink
+		if u, ok := sink.(interface{ Unwrap() Sink }); ok {
+			target = u.Unwrap()
+		}
+
+		send := []Sample{sample}
+		if isAlertSink(target) {
+			send = []Sample{breach, sample}
+		}
+		done := make(chan error, 1)
+		go func() {
+			for _, s := range send {
+				if err := target.Send(s); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(sinkTestTimeout):
+			err = fmt.Errorf("timed out after %s", sinkTestTimeout)
+		}
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", sink.Name(), err)
+		} else {
+			fmt.Fprintf(w, "OK    %s\n", sink.Name())
+		}
+	}
+	return failed
+}
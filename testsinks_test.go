@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestTestSinksAlertSinksGetATransition(t *testing.T) {
+	plain, alerts := &recordSink{}, &recordSink{}
+	if failed := testSinks(io.Discard, []Sink{plain, alertRecordSink{alerts}}); failed != 0 {
+		t.Fatalf("%d sinks failed", failed)
+	}
+	if len(plain.got) != 1 || plain.got[0].Severity != "ok" {
+		t.Errorf("plain sink got %+v, want one ok sample", plain.got)
+	}
+	if len(alerts.got) != 2 || alerts.got[0].Severity != "crit" || alerts.got[1].Severity != "ok" {
+		t.Fatalf("alert sink got %+v, want crit then ok", alerts.got)
+	}
+	// A fresh tracker must treat both as transitions, or the test sends nothing.
+	tracker := newAlertTracker()
+	for _, s := range alerts.got {
+		if _, ok := tracker.check(s); !ok {
+			t.Fatalf("%s test sample would be dropped by the alert tracker", s.Severity)
+		}
+		tracker.record(s)
+	}
+}
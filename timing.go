@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// --- Collection Timing ---
+
+// collectBuckets are histogram upper bounds in seconds, sized to separate
+// in-process reads from forks (systemctl) and network checks.
+var collectBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// durationHistogram accumulates collection latency for one metric type.
+// Counts are cumulative (Prometheus style); one extra bucket holds +Inf.
+type durationHistogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64 // seconds
+}
+
+// collectTimings is keyed by metric type. It is filled in before the first
+// collection and only read afterwards, so the map itself needs no lock.
+var collectTimings = map[string]*durationHistogram{}
+
+func (h *durationHistogram) observe(d time.Duration) {
+	sec := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(collectBuckets)+1)
+	}
+	for i, b := range collectBuckets {
+		if sec <= b {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(collectBuckets)]++
+	h.count++
+	h.sum += sec
+}
+
+// snapshot returns copies of the cumulative bucket counts, count and sum.
+func (h *durationHistogram) snapshot() ([]uint64, uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make([]uint64, len(collectBuckets)+1)
+	copy(counts, h.counts)
+	return counts, h.count, h.sum
+}
+
+// registerCollectTimers creates a histogram per metric type in use and
+// exposes the mean collection time since the previous reading as
+// _self_collect_ms_<type>.
+func registerCollectTimers(states map[string]*MetricState) {
+	for _, s := range states {
+		typ := s.Config.Type
+		if _, ok := collectTimings[typ]; ok {
+			continue
+		}
+		h := &durationHistogram{}
+		collectTimings[typ] = h
+
+		var lastCount uint64
+		var lastSum float64
+		registerSelfMetric("collect_ms_"+typ, func() float64 {
+			_, count, sum := h.snapshot()
+			n, total := count-lastCount, sum-lastSum
+			lastCount, lastSum = count, sum
+			if n == 0 {
+				return 0
+			}
+			return total / float64(n) * 1000
+		})
+	}
+}
+
+func observeCollect(typ string, d time.Duration) {
+	if h, ok := collectTimings[typ]; ok {
+		h.observe(d)
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- Minimal TOML Decoder ---
+//
+// Supports the subset a stat-monitor config needs: [tables] (including
+// dotted and quoted names like [metrics."disk_root"]), bare/quoted/dotted
+// keys, basic and literal strings, integers, floats, booleans, arrays
+// (which may span lines) and inline tables. Durations are plain strings
+// ("30s") and are converted by the same path as YAML. Within the subset
+// the TOML 1.0 rules hold: anything else is an error, not a guess.
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func parseTOML(src string) (map[string]any, error) {
+	p := &tomlParser{src: src, line: 1}
+	root := map[string]any{}
+	current, currentKeys := root, []string(nil)
+	// Tables may only be defined once, by a [header] or an inline table.
+	defined := map[string]bool{}
+
+	for {
+		p.skipSpaceAndComments(true)
+		if p.eof() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			if strings.HasPrefix(p.src[p.pos:], "[[") {
+				return nil, p.errorf("arrays of tables are not supported")
+			}
+			p.pos++
+			keys, err := p.parseKeyPath()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.eof() || p.peek() != ']' {
+				return nil, p.errorf("expected ']'")
+			}
+			p.pos++
+			if defined[tomlPath(keys)] {
+				return nil, p.errorf("table [%s] defined twice", strings.Join(keys, "."))
+			}
+			defined[tomlPath(keys)] = true
+			currentKeys = keys
+			if current, err = tomlTable(root, keys); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+		} else {
+			keys, err := p.parseKeyPath()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.eof() || p.peek() != '=' {
+				return nil, p.errorf("expected '='")
+			}
+			p.pos++
+			p.skipSpace()
+			val, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			table, err := tomlTable(current, keys[:len(keys)-1])
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			last := keys[len(keys)-1]
+			if _, exists := table[last]; exists {
+				return nil, p.errorf("duplicate key %q", last)
+			}
+			table[last] = val
+			if _, ok := val.(map[string]any); ok {
+				defined[tomlPath(append(currentKeys[:len(currentKeys):len(currentKeys)], keys...))] = true
+			}
+		}
+
+		// Only a comment may follow on the same line.
+		p.skipSpace()
+		if !p.eof() && p.peek() == '#' {
+			p.skipComment()
+		}
+		if !p.eof() && p.peek() != '\n' && p.peek() != '\r' {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+	}
+}
+
+// tomlPath joins a table's keys into one map key.
+func tomlPath(keys []string) string {
+	return strings.Join(keys, "\x00")
+}
+
+// tomlTable walks (creating as needed) nested tables under m.
+func tomlTable(m map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys {
+		next, ok := m[k]
+		if !ok {
+			t := map[string]any{}
+			m[k] = t
+			m = t
+			continue
+		}
+		t, ok := next.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not a table", k)
+		}
+		m = t
+	}
+	return m, nil
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.src) }
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("toml line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// skipSpaceAndComments skips blanks and comments, and newlines too when
+// multiline is set (between statements and inside arrays).
+func (p *tomlParser) skipSpaceAndComments(multiline bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && multiline:
+			p.pos++
+			p.line++
+		case c == '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) parseKeyPath() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+		var key string
+		var err error
+		switch p.peek() {
+		case '"':
+			key, err = p.parseBasicString()
+		case '\'':
+			key, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			key = p.src[start:p.pos]
+			if key == "" {
+				return nil, p.errorf("expected key")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		p.skipSpace()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *tomlParser) parseValue() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+	switch c := p.peek(); {
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return nil, p.errorf("multi-line strings are not supported")
+		}
+		return p.parseBasicString()
+	case c == '\'':
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	}
+
+	// Scalars run until a delimiter.
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	tok := p.src[start:p.pos]
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, p.errorf("special float %q is not supported", tok)
+	}
+	clean := strings.ReplaceAll(tok, "_", "")
+	switch {
+	case tomlDecimal.MatchString(tok):
+		if i, err := strconv.ParseInt(clean, 10, 64); err == nil {
+			return i, nil
+		}
+	case tomlPrefixed.MatchString(tok):
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[tok[1]]
+		if i, err := strconv.ParseInt(clean[2:], base, 64); err == nil {
+			return i, nil
+		}
+	case tomlFloat.MatchString(tok):
+		if f, err := strconv.ParseFloat(clean, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, p.errorf("invalid value %q", tok)
+}
+
+// TOML numbers have no leading zeros, underscores only between digits, and
+// no sign on 0x/0o/0b integers. Floats need a fraction or an exponent; a
+// plain integer matches tomlDecimal first.
+var (
+	tomlDecimal  = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlPrefixed = regexp.MustCompile(`^0(x[0-9a-fA-F](_?[0-9a-fA-F])*|o[0-7](_?[0-7])*|b[01](_?[01])*)$`)
+	tomlFloat    = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+)
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			esc := p.peek()
+			p.pos++
+			switch esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(esc)
+			case 'u', 'U':
+				n := 4
+				if esc == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.src) {
+					return "", p.errorf("short unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+				if err != nil {
+					return "", p.errorf("bad unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += n
+			default:
+				return "", p.errorf("unknown escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++ // opening quote
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.pos++ // [
+	arr := []any{}
+	for {
+		p.skipSpaceAndComments(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return arr, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+		// Elements are comma separated; a trailing comma is allowed.
+		p.skipSpaceAndComments(true)
+		switch {
+		case p.eof():
+			return nil, p.errorf("unterminated array")
+		case p.peek() == ',':
+			p.pos++
+		case p.peek() != ']':
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+	p.pos++ // {
+	m := map[string]any{}
+	p.skipSpace()
+	if !p.eof() && p.peek() == '}' {
+		p.pos++
+		return m, nil
+	}
+	for {
+		keys, err := p.parseKeyPath()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("expected '='")
+		}
+		p.pos++
+		p.skipSpace()
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		table, err := tomlTable(m, keys[:len(keys)-1])
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		last := keys[len(keys)-1]
+		if _, exists := table[last]; exists {
+			return nil, p.errorf("duplicate key %q", last)
+		}
+		table[last] = v
+		// Unlike arrays, inline tables take no trailing comma.
+		p.skipSpace()
+		switch {
+		case p.eof():
+			return nil, p.errorf("unterminated inline table")
+		case p.peek() == '}':
+			p.pos++
+			return m, nil
+		case p.peek() != ',':
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+		p.pos++
+	}
+}
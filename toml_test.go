@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{"scalars", `
+s = "a\tb \u00e9"
+lit = 'C:\path'
+t = true
+f = false
+`, map[string]any{"s": "a\tb é", "lit": `C:\path`, "t": true, "f": false}},
+		{"integers", `
+zero = 0
+neg = -17
+plus = +5
+big = 1_000_000
+hex = 0xdead_BEEF
+oct = 0o755
+bin = 0b1010
+`, map[string]any{"zero": int64(0), "neg": int64(-17), "plus": int64(5), "big": int64(1000000),
+			"hex": int64(0xdeadbeef), "oct": int64(0o755), "bin": int64(10)}},
+		{"floats", `
+a = 0.5
+b = -1.25e3
+c = 6E-1
+d = 1_0.0_1
+`, map[string]any{"a": 0.5, "b": -1250.0, "c": 0.6, "d": 10.01}},
+		{"tables", `
+# comment
+[global]
+check_frequency = "1s" # trailing comment
+
+[metrics."disk root"]
+type = "disk"
+
+[metrics.cpu]
+type = "cpu"
+`, map[string]any{
+			"global": map[string]any{"check_frequency": "1s"},
+			"metrics": map[string]any{
+				"disk root": map[string]any{"type": "disk"},
+				"cpu":       map[string]any{"type": "cpu"},
+			},
+		}},
+		{"implicit parent then parent", `
+[a.b]
+x = 1
+[a]
+y = 2
+`, map[string]any{"a": map[string]any{"b": map[string]any{"x": int64(1)}, "y": int64(2)}}},
+		{"dotted keys", `
+outputs.log.enabled = false
+`, map[string]any{"outputs": map[string]any{"log": map[string]any{"enabled": false}}}},
+		{"arrays", `
+empty = []
+paths = ["/", "/var",]
+multi = [
+  1, # one
+  2,
+]
+nested = [[1, 2], ["a"]]
+`, map[string]any{
+			"empty":  []any{},
+			"paths":  []any{"/", "/var"},
+			"multi":  []any{int64(1), int64(2)},
+			"nested": []any{[]any{int64(1), int64(2)}, []any{"a"}},
+		}},
+		{"inline tables", `
+empty = {}
+point = { x = 1, y = "two", z.w = 3 }
+`, map[string]any{
+			"empty": map[string]any{},
+			"point": map[string]any{"x": int64(1), "y": "two", "z": map[string]any{"w": int64(3)}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.src)
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got  %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // Substring of the error
+	}{
+		{"array without comma", `a = [1 2]`, "expected ',' or ']'"},
+		{"array of strings without comma", "a = [\"x\"\n\"y\"]", "expected ',' or ']'"},
+		{"unterminated array", `a = [1, 2`, "unterminated array"},
+		{"inline table without comma", `a = { x = 1 y = 2 }`, "expected ',' or '}'"},
+		{"inline table trailing comma", `a = { x = 1, }`, "expected key"},
+		{"inline table duplicate key", `a = { x = 1, x = 2 }`, "duplicate key"},
+		{"leading zero", `a = 0755`, "invalid value"},
+		{"negative leading zero", `a = -01`, "invalid value"},
+		{"signed hex", `a = -0x1f`, "invalid value"},
+		{"uppercase prefix", `a = 0XFF`, "invalid value"},
+		{"leading underscore", `a = _1`, "invalid value"},
+		{"trailing underscore", `a = 1_`, "invalid value"},
+		{"double underscore", `a = 1__0`, "invalid value"},
+		{"bare dot float", `a = .5`, "invalid value"},
+		{"float without fraction digits", `a = 1.`, "invalid value"},
+		{"float with leading zero", `a = 01.5`, "invalid value"},
+		{"integer overflow", `a = 9223372036854775808`, "invalid value"},
+		{"duplicate table", "[a]\nx = 1\n[a]\ny = 2", "defined twice"},
+		{"duplicate nested table", "[a.b]\n[a.b]", "defined twice"},
+		{"table over inline table", "a = { x = 1 }\n[a]", "defined twice"},
+		{"nested table over inline table", "[m]\na = { x = 1 }\n[m.a]", "defined twice"},
+		{"duplicate key", "a = 1\na = 2", "duplicate key"},
+		{"table over value", "a = 1\n[a.b]", "not a table"},
+		{"two values on a line", `a = 1 b = 2`, "unexpected"},
+		{"array of tables", `[[a]]`, "not supported"},
+		{"multi-line string", `a = """x"""`, "not supported"},
+		{"unterminated string", `a = "x`, "unterminated string"},
+		{"bad escape", `a = "\q"`, "unknown escape"},
+		{"special float", `a = inf`, "not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.src)
+			if err == nil {
+				t.Fatalf("parsed %q, want error containing %q", tt.src, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadConfigTOML checks that a .toml file decodes into the typed config,
+// durations included.
+func TestLoadConfigTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	src := `
+[global]
+check_frequency = "5s"
+
+[metrics.disk_root]
+type = "disk"
+path = "/"
+diff = 5
+warn = 90
+sinks = ["log"]
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Global.CheckFrequency.String() != "5s" {
+		t.Errorf("check_frequency %s, want 5s", cfg.Global.CheckFrequency)
+	}
+	m := cfg.Metrics["disk_root"]
+	if m.Type != "disk" || m.Path != "/" || m.Diff != 5 || m.Warn == nil || *m.Warn != 90 || len(m.Sinks) != 1 {
+		t.Errorf("disk_root decoded as %+v", m)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- WebSocket Broadcast Stream ---
+//
+// GET /ws on the HTTP status server upgrades to a WebSocket (RFC 6455) and
+// streams every broadcast routed to the "websocket" sink as a JSON text
+// message, starting with the last broadcast of every metric. The protocol
+// is small enough to do by hand on a hijacked connection.
+
+const (
+	wsPath         = "/ws"
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsStreamBuffer = 256 // Samples queued per client before dropping
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WebSocket opcodes.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xa
+)
+
+// wsBroadcasts is the "websocket" sink, set up when global.http_websocket is set.
+var wsBroadcasts *wsSink
+
+type wsSink struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+}
+
+type wsClient struct {
+	ch      chan Sample
+	dropped int
+
+	writeMu sync.Mutex
+	conn    net.Conn
+}
+
+func newWSSink() *wsSink {
+	return &wsSink{clients: make(map[*wsClient]struct{})}
+}
+
+func (ws *wsSink) Name() string { return "websocket" }
+
+// Send hands the sample to every client without blocking.
+func (ws *wsSink) Send(s Sample) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for c := range ws.clients {
+		select {
+		case c.ch <- s:
+		default:
+			c.dropped++
+		}
+	}
+	return nil
+}
+
+func (ws *wsSink) add(c *wsClient) {
+	ws.mu.Lock()
+	ws.clients[c] = struct{}{}
+	ws.mu.Unlock()
+}
+
+func (ws *wsSink) remove(c *wsClient) int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	delete(ws.clients, c)
+	return c.dropped
+}
+
+// wsMessage is what clients receive: the shared JSON record plus the
+// human-readable line.
+type wsMessage struct {
+	sampleRecord
+	Text string `json:"text"`
+}
+
+func serveWebSocket(w http.ResponseWriter, r *http.Request, states map[string]*MetricState) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	// Register before taking the snapshot so nothing broadcast in between
+	// is missed; at worst a sample arrives twice.
+	c := &wsClient{ch: make(chan Sample, wsStreamBuffer), conn: conn}
+	wsBroadcasts.add(c)
+	defer func() {
+		if dropped := wsBroadcasts.remove(c); dropped > 0 {
+			logWarnf("WebSocket client %s was too slow, dropped %d samples", r.RemoteAddr, dropped)
+		}
+	}()
+
+	done := make(chan struct{})
+	go c.readLoop(rw.Reader, done)
+
+	for _, s := range snapshotSamples(states) {
+		if c.sendSample(s) != nil {
+			return
+		}
+	}
+	logDebugf("WebSocket client %s connected", r.RemoteAddr)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			logDebugf("WebSocket client %s disconnected", r.RemoteAddr)
+			return
+		case s := <-c.ch:
+			if c.sendSample(s) != nil {
+				return
+			}
+		case <-ping.C:
+			if c.writeFrame(wsPing, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsClient) sendSample(s Sample) error {
+	msg, err := json.Marshal(wsMessage{sampleRecord: newSampleRecord(s), Text: s.Text()})
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, msg)
+}
+
+// readLoop consumes client frames, answering pings and closes, until the
+// connection ends. Clients aren't expected to send data; it is discarded.
+func (c *wsClient) readLoop(r *bufio.Reader, done chan<- struct{}) {
+	defer close(done)
+	for {
+		op, payload, err := readWSFrame(r)
+		if err != nil {
+			return
+		}
+		switch op {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return
+		}
+	}
+}
+
+// writeFrame sends one unmasked, unfragmented frame.
+func (c *wsClient) writeFrame(op byte, payload []byte) error {
+	hdr := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, byte(n))
+	case n <= 0xffff:
+		hdr = append(hdr, 126)
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr = append(hdr, 127)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(append(hdr, payload...))
+	return err
+}
+
+// readWSFrame reads one client frame and unmasks it. Control frames may be
+// interleaved with fragments, so fragments are returned as they come.
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	op := hdr[0] & 0x0f
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > 1<<20 {
+		return 0, nil, io.ErrShortBuffer
+	}
+	var mask [4]byte
+	masked := hdr[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, payload, nil
+}
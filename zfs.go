@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// zpoolStat is one line of `zpool list`.
+type zpoolStat struct {
+	Name, Health  string
+	Capacity      float64 // Percent allocated
+	Fragmentation float64 // Percent; -1 when the pool doesn't report it
+	Free          float64 // Bytes
+}
+
+// listZpools runs `zpool list` once for all pools, in parsable (-p) form.
+func listZpools(ctx context.Context) ([]zpoolStat, error) {
+	path, err := exec.LookPath("zpool")
+	if err != nil {
+		return nil, fmt.Errorf("zpool not found: %w", errUnsupported)
+	}
+	out, err := exec.CommandContext(ctx, path, "list", "-Hp", "-o", "name,health,capacity,fragmentation,free").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return nil, fmt.Errorf("zpool list: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zpool list: %w", err)
+	}
+	var pools []zpoolStat
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) != 5 {
+			continue
+		}
+		p := zpoolStat{Name: f[0], Health: f[1], Fragmentation: -1}
+		p.Capacity, _ = strconv.ParseFloat(strings.TrimSuffix(f[2], "%"), 64)
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(f[3], "%"), 64); err == nil {
+			p.Fragmentation = v
+		}
+		p.Free, _ = strconv.ParseFloat(f[4], 64)
+		pools = append(pools, p)
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("no pools: %w", errUnsupported)
+	}
+	return pools, nil
+}
+
+// zfsValue reads one measure for pool, or for the worst of all pools when
+// pool is empty: healthy (the default) is 1 only while every selected pool
+// is ONLINE, capacity_percent and fragmentation_percent are the highest,
+// and free_gb the lowest.
+func zfsValue(ctx context.Context, pool, measure string) (float64, error) {
+	pools, err := currentTick().zpools(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var vals []float64
+	how := "max"
+	for _, p := range pools {
+		if pool != "" && p.Name != pool {
+			continue
+		}
+		switch measure {
+		case "healthy", "":
+			how = "min"
+			if p.Health == "ONLINE" {
+				vals = append(vals, 1)
+			} else {
+				vals = append(vals, 0)
+			}
+		case "capacity_percent":
+			vals = append(vals, p.Capacity)
+		case "fragmentation_percent":
+			if p.Fragmentation < 0 {
+				return 0, fmt.Errorf("pool %s does not report fragmentation", p.Name)
+			}
+			vals = append(vals, p.Fragmentation)
+		case "free_gb":
+			how = "min"
+			vals = append(vals, p.Free/1024/1024/1024)
+		default:
+			return 0, fmt.Errorf("unknown zfs measure %q", measure)
+		}
+	}
+	if len(vals) == 0 {
+		return 0, fmt.Errorf("pool %q not found", pool)
+	}
+	return aggregate(vals, how)
+}